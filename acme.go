@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const letsEncryptDirectory string = "https://acme-v02.api.letsencrypt.org/directory"
+const acmeTimeout time.Duration = 5 * time.Minute // Time a certificate may take to be issued, validation included
+
+// acmeOptions configures the ACME server certificates are requested from and where they are stored
+type acmeOptions struct {
+	DirectoryURL  string
+	DirectoryCA   string // PEM file trusted for the HTTPS connection to the ACME server, for test servers like Pebble
+	Email         string
+	AccountKey    string // Created when it doesn't exist
+	Dir           string // Certificates are written to Dir/<first name>/fullchain.pem, chain.pem and privkey.pem
+	Webroot       string // The challenge config serves Webroot/.well-known/acme-challenge/
+	ChallengePort int
+	Apply         applyOptions
+}
+
+// acmeService is an HTTPS service of a service file and the names its certificate has to cover
+type acmeService struct {
+	Index int
+	Names []string
+}
+
+func runACME(args []string) int {
+	flags := newFlagSet("acme")
+	directory := flags.String("directory", letsEncryptDirectory, "ACME directory URL of the CA")
+	directoryCA := flags.String("directory-ca", "", "PEM file with the CA to trust for the ACME directory, for test servers")
+	email := flags.String("email", "", "contact address of the ACME account")
+	accountKey := flags.String("account-key", "", "key of the ACME account, created when it doesn't exist (default <dir>/account.key)")
+	dir := flags.String("dir", "/etc/nginx/acme", "directory to store the certificates in")
+	webroot := flags.String("webroot", "/var/www/acme", "directory nginx serves the challenge responses from")
+	challengePort := flags.Int("challenge-port", 80, "port the challenge config listens on")
+	split := flags.Bool("split", false, "install one config per service for files with [[service]] tables")
+	apply := addApplyFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	options := acmeOptions{
+		DirectoryURL:  *directory,
+		DirectoryCA:   *directoryCA,
+		Email:         *email,
+		AccountKey:    *accountKey,
+		Dir:           getAbsolutePath(*dir),
+		Webroot:       getAbsolutePath(*webroot),
+		ChallengePort: *challengePort,
+		Apply:         apply(),
+	}
+	if options.AccountKey == "" {
+		options.AccountKey = filepath.Join(options.Dir, "account.key")
+	}
+
+	path := flags.Arg(0)
+	file, err := loadServiceFile(path)
+	if err == nil {
+		err = file.check(false) // The certificates are checked once they are issued
+	}
+	var services []acmeService
+	if err == nil {
+		services, err = acmeServices(file)
+	}
+	if err != nil {
+		red.Println("Error occoured while reading config from", path, "Details: \n", err.Error())
+		return exitError
+	}
+
+	challengeConfig := renderedConfig{
+		FileName: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "-acme",
+		Contents: acmeChallengeConfig(services, options),
+	}
+	if err := applyConfigs([]renderedConfig{challengeConfig}, options.Apply); err != nil {
+		red.Println("Error occoured while installing the challenge config, previous config restored. Details:\n", err.Error())
+		return exitError
+	}
+	fmt.Printf("Installed challenge config %s\n", filepath.Join(options.Apply.SitesAvailable, challengeConfig.FileName+".conf"))
+	issued, err := obtainCertificates(file, services, options)
+	if removeErr := removeConfigs([]renderedConfig{challengeConfig}, options.Apply); removeErr != nil {
+		red.Println("Error occoured while removing the challenge config. Details:\n", removeErr.Error())
+		return exitError
+	}
+	if err == nil {
+		err = setServiceCertificates(path, file, issued)
+	}
+	if err != nil {
+		red.Println("Error occoured while obtaining certificates for", path, "Details: \n", err.Error())
+		return exitError
+	}
+	for _, certificate := range issued {
+		fmt.Printf("Obtained certificate for %s, stored in %s\n", strings.Join(certificate.Names, ", "), filepath.Dir(certificate.Certificate))
+	}
+	fmt.Printf("Updated %s to use the certificates, backup written to %s\n", path, path+".bak")
+	return applyServiceFile(path, *split, true, options.Apply)
+}
+
+// acmeServices returns the HTTPS services of file, their names have to be validated over HTTP so wildcards can't be used
+func acmeServices(file serviceFile) ([]acmeService, error) {
+	var services []acmeService
+	for i, server := range file.Services {
+		if server.Port != 443 && !server.Additional.TLS.configured() {
+			continue
+		}
+		names, err := certificateNames(server.Domains)
+		if err != nil {
+			return nil, fmt.Errorf("service[%d]: %s", i, err.Error())
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, "*.") {
+				return nil, fmt.Errorf("service[%d]: HTTP validation can't be used for the wildcard %s", i, name)
+			}
+		}
+		services = append(services, acmeService{Index: i, Names: names})
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no service listens on 443 or has TLS configured")
+	}
+	return services, nil
+}
+
+// acmeChallengeConfig creates a config serving the challenge responses from the webroot for the names of services
+func acmeChallengeConfig(services []acmeService, options acmeOptions) string {
+	blocks := make([]Node, len(services))
+	for i, service := range services {
+		blocks[i] = newBlock("server").add(
+			newDirective("listen", strconv.Itoa(options.ChallengePort)),
+			newDirective("listen", "[::]:"+strconv.Itoa(options.ChallengePort)),
+			newDirective("server_name", service.Names...),
+			acmeChallengeLocation(options.Webroot),
+		)
+	}
+	return printConfig(blocks...)
+}
+
+// acmeChallengeLocation serves the HTTP-01 challenge responses written to webroot
+func acmeChallengeLocation(webroot string) *Directive {
+	return newBlock("location", "^~", "/.well-known/acme-challenge/").add(
+		newDirective("root", webroot),
+		newDirective("default_type", "text/plain"),
+	)
+}
+
+// obtainCertificates registers the ACME account and orders a certificate for each of services
+func obtainCertificates(file serviceFile, services []acmeService, options acmeOptions) ([]issuedCertificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeTimeout)
+	defer cancel()
+	client, err := newACMEClient(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	var issued []issuedCertificate
+	for _, service := range services {
+		certificate, err := obtainCertificate(ctx, client, service.Names, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Services[service.Index].Domains, err.Error())
+		}
+		certificate.Index = service.Index
+		issued = append(issued, certificate)
+	}
+	return issued, nil
+}
+
+// newACMEClient creates a client for the ACME server with a registered account
+func newACMEClient(ctx context.Context, options acmeOptions) (*acme.Client, error) {
+	key, err := loadOrCreateKey(options.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: options.DirectoryURL, UserAgent: "nginx-auto-config/" + version}
+	if options.DirectoryCA != "" {
+		caPEM, err := ioutil.ReadFile(options.DirectoryCA)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("%s has no PEM encoded certificates", options.DirectoryCA)
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	}
+	account := &acme.Account{}
+	if options.Email != "" {
+		account.Contact = []string{"mailto:" + options.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, fmt.Errorf("registering ACME account: %s", err.Error())
+	}
+	return client, nil
+}
+
+// obtainCertificate orders a certificate for names, answering HTTP-01 challenges through the webroot
+func obtainCertificate(ctx context.Context, client *acme.Client, names []string, options acmeOptions) (issuedCertificate, error) {
+	certificate := issuedCertificate{Names: names}
+	identifiers := make([]acme.AuthzID, len(names))
+	for i, name := range names {
+		identifiers[i] = acme.AuthzID{Type: "dns", Value: name}
+		if net.ParseIP(name) != nil {
+			identifiers[i].Type = "ip"
+		}
+	}
+	order, err := client.AuthorizeOrder(ctx, identifiers)
+	if err != nil {
+		return certificate, err
+	}
+	for _, authorizationURL := range order.AuthzURLs {
+		authorization, err := client.GetAuthorization(ctx, authorizationURL)
+		if err != nil {
+			return certificate, err
+		}
+		if authorization.Status == acme.StatusValid {
+			continue
+		}
+		var challenge *acme.Challenge
+		for _, offered := range authorization.Challenges {
+			if offered.Type == "http-01" {
+				challenge = offered
+			}
+		}
+		if challenge == nil {
+			return certificate, fmt.Errorf("no HTTP-01 challenge offered for %s", authorization.Identifier.Value)
+		}
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return certificate, err
+		}
+		responsePath := filepath.Join(options.Webroot, filepath.FromSlash(client.HTTP01ChallengePath(challenge.Token)))
+		if err := os.MkdirAll(filepath.Dir(responsePath), 0755); err != nil {
+			return certificate, err
+		}
+		if err := writeContentToFile(responsePath, []byte(response)); err != nil {
+			return certificate, err
+		}
+		defer os.Remove(responsePath)
+		if _, err := client.Accept(ctx, challenge); err != nil {
+			return certificate, err
+		}
+		if _, err := client.WaitAuthorization(ctx, authorization.URI); err != nil {
+			return certificate, fmt.Errorf("validating %s: %s", authorization.Identifier.Value, err.Error())
+		}
+	}
+	orderURL := order.URI // Orders fetched again don't carry their URL
+	if order, err = client.WaitOrder(ctx, orderURL); err != nil {
+		return certificate, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return certificate, err
+	}
+	request := &x509.CertificateRequest{Subject: pkix.Name{CommonName: names[0]}}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			request.IPAddresses = append(request.IPAddresses, ip)
+		} else {
+			request.DNSNames = append(request.DNSNames, name)
+		}
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, request, key)
+	if err != nil {
+		return certificate, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil && !isOrderStillProcessing(err) {
+		return certificate, fmt.Errorf("finalizing the order: %s", err.Error())
+	}
+	if err != nil {
+		// CAs finalizing in the background (like Pebble) may not return the order URL CreateOrderCert waits on
+		finalizeErr := err
+		if order, err = client.WaitOrder(ctx, orderURL); err != nil {
+			return certificate, fmt.Errorf("finalizing the order: %s, then waiting for it: %s", finalizeErr.Error(), err.Error())
+		}
+		if chain, err = client.FetchCert(ctx, order.CertURL, true); err != nil {
+			return certificate, err
+		}
+	}
+
+	dir := filepath.Join(options.Dir, names[0])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return certificate, err
+	}
+	fullchainPEM, keyPEM, err := encodeCertificate(chain[0], key)
+	if err != nil {
+		return certificate, err
+	}
+	var intermediatesPEM []byte
+	for _, der := range chain[1:] {
+		intermediatesPEM = append(intermediatesPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	certificate.Certificate = filepath.Join(dir, "fullchain.pem")
+	certificate.Key = filepath.Join(dir, "privkey.pem")
+	if err := writeKeyPair(certificate.Certificate, append(fullchainPEM, intermediatesPEM...), certificate.Key, keyPEM); err != nil {
+		return certificate, err
+	}
+	if len(intermediatesPEM) > 0 {
+		certificate.Chain = filepath.Join(dir, "chain.pem")
+		if err := writeContentToFile(certificate.Chain, intermediatesPEM); err != nil {
+			return certificate, err
+		}
+	}
+	return certificate, nil
+}
+
+// loadOrCreateKey reads the private key at path, creating an ECDSA key there when it doesn't exist
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	if !fileExists(path) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		return key, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	}
+	return readPrivateKey(path)
+}
+
+// isOrderStillProcessing reports whether CreateOrderCert failed waiting on an order the CA is still finalizing, either
+// as it returned no order URL to wait on or as the order is processing, rather than the CA rejecting the order
+func isOrderStillProcessing(err error) bool {
+	var urlError *url.Error
+	var orderError *acme.OrderError
+	switch {
+	case errors.As(err, &orderError):
+		return orderError.Status == acme.StatusProcessing
+	case errors.As(err, &urlError):
+		return urlError.URL == ""
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACMEChallengeConfig(t *testing.T) {
+	file := serviceFile{Multiple: true, Services: []Service{
+		{Selection: 5, Domains: "sidsun.com .sulabs.org", URL: "http://127.0.0.1:8000", Port: 443},
+		{Selection: 8, Domains: "_", Port: 80},
+		{Selection: 1, Domains: "static.sidsun.com", Root: "/srv/www", Port: 8443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}}},
+	}}
+	_, err := acmeServices(file)
+	assert.EqualError(t, err, "service[0]: HTTP validation can't be used for the wildcard *.sulabs.org")
+
+	file.Services[0].Domains = "sidsun.com www.sidsun.com"
+	services, err := acmeServices(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []acmeService{{0, []string{"sidsun.com", "www.sidsun.com"}}, {2, []string{"static.sidsun.com"}}}, services)
+	assert.Equal(t, `server {
+    listen 80;
+    listen [::]:80;
+    server_name sidsun.com www.sidsun.com;
+    location ^~ /.well-known/acme-challenge/ {
+        root /var/www/acme;
+        default_type text/plain;
+    }
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name static.sidsun.com;
+    location ^~ /.well-known/acme-challenge/ {
+        root /var/www/acme;
+        default_type text/plain;
+    }
+}
+`, acmeChallengeConfig(services, acmeOptions{Webroot: "/var/www/acme", ChallengePort: 80}))
+}
+
+// TestRunACME issues a certificate from a local ACME test server, it runs when NGINX_AUTO_CONFIG_ACME_DIRECTORY is set
+// For Pebble: NGINX_AUTO_CONFIG_ACME_DIRECTORY=https://localhost:14000/dir NGINX_AUTO_CONFIG_ACME_CA=test/certs/pebble.minica.pem
+// NGINX_AUTO_CONFIG_ACME_PORT=5002, the port Pebble validates HTTP-01 challenges on, which the test serves the webroot at
+func TestRunACME(t *testing.T) {
+	directory := os.Getenv("NGINX_AUTO_CONFIG_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("NGINX_AUTO_CONFIG_ACME_DIRECTORY is not set")
+	}
+	port := os.Getenv("NGINX_AUTO_CONFIG_ACME_PORT")
+	if port == "" {
+		port = "5002"
+	}
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	available := filepath.Join(dir, "sites-available")
+	enabled := filepath.Join(dir, "sites-enabled")
+	assert.NoError(t, os.Mkdir(available, 0755))
+	assert.NoError(t, os.Mkdir(enabled, 0755))
+	webroot := filepath.Join(dir, "webroot")
+
+	// nginx is replaced by a file server for the webroot and a stub recording which configs were enabled when reloading
+	server := &http.Server{Addr: ":" + port, Handler: http.FileServer(http.Dir(webroot))}
+	go func() { _ = server.ListenAndServe() }()
+	defer server.Close()
+	nginx := filepath.Join(dir, "nginx")
+	calls := filepath.Join(dir, "calls")
+	assert.NoError(t, ioutil.WriteFile(nginx, []byte("#!/bin/sh\necho \"$@\" $(ls "+enabled+") >> "+calls+"\n"), 0755))
+
+	path := filepath.Join(dir, "localhost.toml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("Selection = 5\nDomains = \"localhost\"\nURL = \"http://127.0.0.1:8000\"\nPort = 443\n"), 0644))
+	args := []string{
+		"--directory", directory,
+		"--dir", filepath.Join(dir, "acme"),
+		"--webroot", webroot,
+		"--sites-available", available,
+		"--sites-enabled", enabled,
+		"--nginx", nginx,
+	}
+	if ca := os.Getenv("NGINX_AUTO_CONFIG_ACME_CA"); ca != "" {
+		args = append(args, "--directory-ca", ca)
+	}
+	assert.Equal(t, exitOK, runACME(append(args, path)))
+
+	recorded, _ := ioutil.ReadFile(calls)
+	assert.Equal(t, []string{
+		"-t localhost-acme.conf",
+		"-s reload localhost-acme.conf",
+		"-t",
+		"-s reload",
+		"-t localhost.conf",
+		"-s reload localhost.conf",
+	}, strings.Split(strings.TrimSpace(string(recorded)), "\n"))
+	file, err := loadServiceFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "acme", "localhost", "fullchain.pem"), file.Services[0].Additional.TLS.Certificate)
+	assert.NoError(t, file.check(true))
+	contents, _ := ioutil.ReadFile(filepath.Join(available, "localhost.conf"))
+	assert.Contains(t, string(contents), "ssl_certificate "+filepath.Join(dir, "acme", "localhost", "fullchain.pem")+";")
+	assert.False(t, fileExists(filepath.Join(available, "localhost-acme.conf")))
+}
+
+func TestIsOrderStillProcessing(t *testing.T) {
+	assert.True(t, isOrderStillProcessing(&url.Error{Op: "Post", URL: "", Err: errors.New("unsupported protocol scheme \"\"")}))
+	assert.True(t, isOrderStillProcessing(&acme.OrderError{Status: acme.StatusProcessing}))
+	assert.False(t, isOrderStillProcessing(&acme.OrderError{Status: acme.StatusInvalid}))
+	assert.False(t, isOrderStillProcessing(&acme.Error{StatusCode: 400, ProblemType: "urn:ietf:params:acme:error:badCSR"}))
+	assert.False(t, isOrderStillProcessing(&url.Error{Op: "Post", URL: "https://ca.example/finalize/1", Err: errors.New("connection refused")}))
+}
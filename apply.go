@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// applyOptions configures where apply installs configs and how nginx is tested and reloaded
+type applyOptions struct {
+	SitesAvailable string
+	SitesEnabled   string
+	TestCommand    []string
+	ReloadCommand  []string
+}
+
+// pathBackup is the state of a path before apply changed it, used to restore it on failure
+type pathBackup struct {
+	Path       string
+	Existed    bool
+	Contents   []byte
+	Mode       os.FileMode
+	LinkTarget string // Set when the path was a symlink
+}
+
+func runApply(args []string) int {
+	flags := newFlagSet("apply")
+	options := addApplyFlags(flags)
+	split := flags.Bool("split", false, "install one config per service for files with [[service]] tables")
+	skipTLSCheck := flags.Bool("skip-tls-check", false, "don't check that the certificate files exist and match")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	return applyServiceFile(flags.Arg(0), *split, !*skipTLSCheck, options())
+}
+
+// addApplyFlags defines the flags choosing where configs are installed and how nginx is tested and reloaded, the
+// returned function reads them into applyOptions once the flags are parsed
+func addApplyFlags(flags *flag.FlagSet) func() applyOptions {
+	sitesAvailable := flags.String("sites-available", "/etc/nginx/sites-available", "directory to write the configs to")
+	sitesEnabled := flags.String("sites-enabled", "/etc/nginx/sites-enabled", "directory to create the symlinks to the configs in")
+	nginx := flags.String("nginx", "nginx", "nginx binary used for the default test and reload commands")
+	testCommand := flags.String("test-cmd", "", "command testing the config (default \"<nginx> -t\")")
+	reloadCommand := flags.String("reload-cmd", "", "command reloading nginx (default \"<nginx> -s reload\")")
+	return func() applyOptions {
+		options := applyOptions{
+			SitesAvailable: *sitesAvailable,
+			SitesEnabled:   *sitesEnabled,
+			TestCommand:    []string{*nginx, "-t"},
+			ReloadCommand:  []string{*nginx, "-s", "reload"},
+		}
+		if *testCommand != "" {
+			options.TestCommand = strings.Fields(*testCommand)
+		}
+		if *reloadCommand != "" {
+			options.ReloadCommand = strings.Fields(*reloadCommand)
+		}
+		return options
+	}
+}
+
+// applyServiceFile renders the services in the file at path and installs them, returns the exit code
+func applyServiceFile(path string, split bool, verifyFiles bool, options applyOptions) int {
+	file, err := loadServiceFile(path)
+	if err == nil {
+		err = file.check(verifyFiles)
+	}
+	var configs []renderedConfig
+	if err == nil {
+		configs, err = file.render(split)
+	}
+	if err != nil {
+		red.Println("Error occoured while reading config from", path, "Details: \n", err.Error())
+		return exitError
+	}
+	for _, config := range configs {
+		installed := filepath.Join(options.SitesAvailable, config.FileName+".conf")
+		if existing, exists, err := readExisting(installed); err == nil && exists {
+			printDiff(unifiedDiff(installed, installed+" (generated)", existing, config.Contents))
+		}
+	}
+	if err := applyConfigs(configs, options); err != nil {
+		red.Println("Error occoured while applying config, previous config restored. Details:\n", err.Error())
+		return exitError
+	}
+	for _, config := range configs {
+		fmt.Printf("Installed %s and enabled it in %s, nginx reloaded\n", filepath.Join(options.SitesAvailable, config.FileName+".conf"), options.SitesEnabled)
+	}
+	if file.usesPlaceholderSSL() {
+		printCautionSSL()
+	}
+	return exitOK
+}
+
+// applyConfigs installs configs into sites-available, links them from sites-enabled, tests and reloads nginx
+// When anything fails every touched path is restored to what it was before
+func applyConfigs(configs []renderedConfig, options applyOptions) error {
+	if len(options.TestCommand) == 0 || len(options.ReloadCommand) == 0 {
+		return fmt.Errorf("test and reload commands can not be empty")
+	}
+	var backups []pathBackup
+	restore := func(cause error) error {
+		for i := len(backups) - 1; i >= 0; i-- {
+			if err := restorePath(backups[i]); err != nil {
+				return fmt.Errorf("%s\nrestoring %s failed too: %s", cause.Error(), backups[i].Path, err.Error())
+			}
+		}
+		return cause
+	}
+
+	for _, config := range configs {
+		available, err := filepath.Abs(filepath.Join(options.SitesAvailable, config.FileName+".conf"))
+		if err != nil {
+			return restore(err)
+		}
+		enabled := filepath.Join(options.SitesEnabled, config.FileName+".conf")
+		for _, path := range []string{available, enabled} {
+			backup, err := backupPath(path)
+			if err != nil {
+				return restore(err)
+			}
+			backups = append(backups, backup)
+		}
+		if err := writeContentToFile(available, []byte(config.Contents)); err != nil {
+			return restore(err)
+		}
+		if err := os.Remove(enabled); err != nil && !os.IsNotExist(err) {
+			return restore(err)
+		}
+		if err := os.Symlink(available, enabled); err != nil {
+			return restore(err)
+		}
+	}
+
+	if output, err := runCommand(options.TestCommand); err != nil {
+		return restore(fmt.Errorf("%s failed: %s\n%s", strings.Join(options.TestCommand, " "), err.Error(), output))
+	}
+	if output, err := runCommand(options.ReloadCommand); err != nil {
+		return restore(fmt.Errorf("%s failed: %s\n%s", strings.Join(options.ReloadCommand, " "), err.Error(), output))
+	}
+	return nil
+}
+
+// removeConfigs disables and deletes configs installed by applyConfigs, then tests and reloads nginx
+func removeConfigs(configs []renderedConfig, options applyOptions) error {
+	for _, config := range configs {
+		for _, path := range []string{filepath.Join(options.SitesEnabled, config.FileName+".conf"), filepath.Join(options.SitesAvailable, config.FileName+".conf")} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for _, command := range [][]string{options.TestCommand, options.ReloadCommand} {
+		if output, err := runCommand(command); err != nil {
+			return fmt.Errorf("%s failed: %s\n%s", strings.Join(command, " "), err.Error(), output)
+		}
+	}
+	return nil
+}
+
+// backupPath records the state of path, directories can't be backed up and are reported as an error
+func backupPath(path string) (pathBackup, error) {
+	backup := pathBackup{Path: path}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return backup, nil
+	}
+	if err != nil {
+		return backup, err
+	}
+	backup.Existed = true
+	backup.Mode = info.Mode()
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		backup.LinkTarget, err = os.Readlink(path)
+	case info.IsDir():
+		err = fmt.Errorf("%s is a directory", path)
+	default:
+		backup.Contents, err = ioutil.ReadFile(path)
+	}
+	return backup, err
+}
+
+func restorePath(backup pathBackup) error {
+	if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !backup.Existed {
+		return nil
+	}
+	if backup.LinkTarget != "" {
+		return os.Symlink(backup.LinkTarget, backup.Path)
+	}
+	return ioutil.WriteFile(backup.Path, backup.Contents, backup.Mode.Perm())
+}
+
+func runCommand(command []string) (string, error) {
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	available := filepath.Join(dir, "sites-available")
+	enabled := filepath.Join(dir, "sites-enabled")
+	assert.NoError(t, os.Mkdir(available, 0755))
+	assert.NoError(t, os.Mkdir(enabled, 0755))
+
+	// The stub nginx records its arguments and fails the config test while the fail file exists
+	nginx := filepath.Join(dir, "nginx")
+	calls := filepath.Join(dir, "calls")
+	failFile := filepath.Join(dir, "fail")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\nif [ \"$1\" = \"-t\" ] && [ -e " + failFile + " ]; then echo 'nginx: configuration file test failed'; exit 1; fi\n"
+	assert.NoError(t, ioutil.WriteFile(nginx, []byte(script), 0755))
+	options := applyOptions{
+		SitesAvailable: available,
+		SitesEnabled:   enabled,
+		TestCommand:    []string{nginx, "-t"},
+		ReloadCommand:  []string{nginx, "-s", "reload"},
+	}
+	target := filepath.Join(available, "a.com.conf")
+	link := filepath.Join(enabled, "a.com.conf")
+
+	t.Run("test apply installs, enables and reloads", func(t *testing.T) {
+		assert.NoError(t, applyConfigs([]renderedConfig{{"a.com", "server {}\n"}}, options))
+		contents, _ := ioutil.ReadFile(target)
+		assert.Equal(t, "server {}\n", string(contents))
+		linkTarget, err := os.Readlink(link)
+		assert.NoError(t, err)
+		assert.Equal(t, target, linkTarget)
+		recorded, _ := ioutil.ReadFile(calls)
+		assert.Equal(t, "-t\n-s reload\n", string(recorded))
+	})
+
+	t.Run("test failed config test restores the previous config", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(failFile, nil, 0644))
+		err := applyConfigs([]renderedConfig{{"a.com", "server { broken }\n"}, {"b.com", "server {}\n"}}, options)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "nginx: configuration file test failed")
+		contents, _ := ioutil.ReadFile(target)
+		assert.Equal(t, "server {}\n", string(contents))
+		linkTarget, _ := os.Readlink(link)
+		assert.Equal(t, target, linkTarget)
+		assert.False(t, fileExists(filepath.Join(available, "b.com.conf")))
+		_, err = os.Lstat(filepath.Join(enabled, "b.com.conf"))
+		assert.True(t, os.IsNotExist(err))
+		recorded, _ := ioutil.ReadFile(calls)
+		assert.Equal(t, "-t\n-s reload\n-t\n", string(recorded))
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AuthConfig asks for HTTP basic authentication before serving the service or one of its Locations
+type AuthConfig struct {
+	Realm    string   // Shown by browsers when asking for the credentials, defaultAuthRealm when empty
+	Users    []string // Users of the UserFile, the htpasswd command asks for their passwords
+	UserFile string   // htpasswd file the credentials are checked against, defaultHtpasswdDir/<first domain> when empty
+	Path     string   // Only ask for credentials at the location of Locations with this Path, the whole service when empty
+}
+
+const defaultAuthRealm = "Restricted"
+
+const defaultHtpasswdDir = "/etc/nginx/htpasswd"
+
+// configured reports whether any of the auth settings is set, which enables basic authentication
+func (config AuthConfig) configured() bool {
+	return config.Realm != "" || len(config.Users) > 0 || config.UserFile != "" || config.Path != ""
+}
+
+// userFile returns the htpasswd file of the service whose files are named fileName
+func (config AuthConfig) userFile(fileName string) string {
+	if config.UserFile == "" {
+		return filepath.Join(defaultHtpasswdDir, fileName)
+	}
+	return config.UserFile
+}
+
+// directives returns the auth_basic directives of the service whose files are named fileName
+func (config AuthConfig) directives(fileName string) []Node {
+	realm := config.Realm
+	if realm == "" {
+		realm = defaultAuthRealm
+	}
+	return []Node{
+		newDirective("auth_basic", `"`+realm+`"`),
+		newDirective("auth_basic_user_file", config.userFile(fileName)),
+	}
+}
+
+// validateAuth reports problems with the basic authentication of a service
+func validateAuth(server Service) ValidationErrors {
+	var errs ValidationErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	config := server.Auth
+	if !config.configured() {
+		return nil
+	}
+	if inRange(server.Selection, []int{6, 8}) {
+		add("Auth", "can't be used with preset %d, which redirects every request", server.Selection)
+	}
+	if strings.ContainsAny(config.Realm, "\"\\") {
+		add("Auth.Realm", "%q can't contain quotes or backslashes", config.Realm)
+	} else if config.Realm == "off" {
+		add("Auth.Realm", "off would turn the authentication off, leave Auth empty instead")
+	}
+	if len(config.Users) == 0 {
+		add("Auth.Users", "at least one user is required")
+	}
+	seen := map[string]bool{}
+	for _, user := range config.Users {
+		switch {
+		case user == "" || strings.ContainsAny(user, ": \t\n"):
+			add("Auth.Users", "%q is not a user name without colons and spaces", user)
+		case seen[user]:
+			add("Auth.Users", "%q is listed more than once", user)
+		}
+		seen[user] = true
+	}
+	if config.UserFile != "" && (!strings.HasPrefix(config.UserFile, "/") || strings.ContainsAny(config.UserFile, " \t;{}")) {
+		add("Auth.UserFile", "%q is not an absolute path without spaces, semicolons and braces", config.UserFile)
+	}
+	if config.Path != "" {
+		found, regex := false, false
+		for _, location := range server.Locations {
+			found = found || location.Path == config.Path
+			regex = regex || (location.Path == config.Path && location.Match == "regex")
+		}
+		if regex {
+			add("Auth.Path", "%q is the path of a regex location, the regexes before it could answer its requests without credentials", config.Path)
+		} else if !found {
+			add("Auth.Path", "%q is not the path of one of Locations, leave it empty to protect the whole service", config.Path)
+		}
+	}
+	return errs
+}
+
+// addAuth adds the auth_basic directives of config to the locations of block with the Path of config, when it is a
+// ^~ prefix the longer prefixes under it are protected too as nginx picks the longest one, regexes can't take its
+// requests and the ones nested in it inherit auth_basic
+func addAuth(block *Directive, config AuthConfig, fileName string) {
+	var locations []*Directive
+	prefix := false
+	for _, node := range block.Block {
+		location, ok := node.(*Directive)
+		if !ok || location.Name != "location" || len(location.Args) == 0 {
+			continue
+		}
+		switch args := location.Args; {
+		case len(args) == 2 && (args[0] == "~" || args[0] == "~*"), strings.HasPrefix(args[0], "@"):
+			continue
+		case len(args) == 2 && args[0] == "^~" && args[1] == config.Path:
+			prefix = true
+		}
+		locations = append(locations, location)
+	}
+	for _, location := range locations {
+		path := location.Args[len(location.Args)-1]
+		if path == config.Path || (prefix && strings.HasPrefix(path, config.Path)) {
+			location.Block = append(config.directives(fileName), location.Block...)
+		}
+	}
+}
+
+// isAuthPrefix reports whether path is the Path of a prefix location of server, which addAuth protects with the longer
+// prefixes under it
+func isAuthPrefix(server Service, path string) bool {
+	for _, location := range server.Locations {
+		if location.Path == path && (location.Match == "" || location.Match == "prefix") {
+			return true
+		}
+	}
+	return false
+}
+
+// importAuth reads and removes the auth_basic directives of a server or location block, returns false when it has none
+func importAuth(block *Directive, fileName string) (AuthConfig, bool) {
+	var config AuthConfig
+	var found bool
+	var nodes []Node
+	for _, node := range block.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented || (directive.Name != "auth_basic" && directive.Name != "auth_basic_user_file") || len(directive.Args) != 1 {
+			nodes = append(nodes, node)
+			continue
+		}
+		found = true
+		if directive.Name == "auth_basic" {
+			config.Realm = unquote(directive.Args[0])
+		} else {
+			config.UserFile = unquote(directive.Args[0])
+		}
+	}
+	block.Block = nodes
+	if config.Realm == defaultAuthRealm {
+		config.Realm = ""
+	}
+	if config.UserFile == filepath.Join(defaultHtpasswdDir, fileName) {
+		config.UserFile = ""
+	}
+	return config, found
+}
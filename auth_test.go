@@ -0,0 +1,152 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsAuth(t *testing.T) {
+	testCases := []struct {
+		name             string
+		service          Service
+		expectedContents string
+	}{
+		{
+			name:    "test whole service",
+			service: Service{Selection: 2, Domains: "staging.sidsun.com", Root: "/srv/www", Port: 8080, Auth: AuthConfig{Users: []string{"sid"}}},
+			expectedContents: `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name staging.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    auth_basic "Restricted";
+    auth_basic_user_file /etc/nginx/htpasswd/staging.sidsun.com;
+    location / {
+        root /srv/www;
+    }
+}
+`,
+		},
+		{
+			name: "test location",
+			service: Service{Selection: 5, Domains: "staging.sidsun.com", URL: "http://127.0.0.1:8000", Port: 8080,
+				Locations: []Location{{Path: "/admin/", Selection: 2, Root: "/srv/admin"}},
+				Auth:      AuthConfig{Realm: "Staging admin", Users: []string{"sid", "su"}, UserFile: "/etc/nginx/staging.htpasswd", Path: "/admin/"}},
+			expectedContents: `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name staging.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    location ^~ /admin/ {
+        auth_basic "Staging admin";
+        auth_basic_user_file /etc/nginx/staging.htpasswd;
+        root /srv/admin;
+    }
+    location / {
+        proxy_pass http://127.0.0.1:8000;
+        proxy_read_timeout  90;
+    }
+}
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, fileContents := prepareServiceFileContents(testCase.service)
+			assert.Equal(t, testCase.expectedContents, fileContents)
+		})
+	}
+}
+
+func TestAuthValidate(t *testing.T) {
+	service := Service{Selection: 6, Domains: "sidsun.com", URL: "https://sulabs.org", Port: 443,
+		Auth: AuthConfig{Realm: `"quoted"`, Users: []string{"sid", "s:d", "sid"}, UserFile: "htpasswd", Path: "/admin/"}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Auth", Message: "can't be used with preset 6, which redirects every request"},
+		{Field: "Auth.Realm", Message: `"\"quoted\"" can't contain quotes or backslashes`},
+		{Field: "Auth.Users", Message: `"s:d" is not a user name without colons and spaces`},
+		{Field: "Auth.Users", Message: `"sid" is listed more than once`},
+		{Field: "Auth.UserFile", Message: `"htpasswd" is not an absolute path without spaces, semicolons and braces`},
+		{Field: "Auth.Path", Message: `"/admin/" is not the path of one of Locations, leave it empty to protect the whole service`},
+	}, service.Validate())
+
+	service = Service{Selection: 1, Domains: "sidsun.com", Root: "/srv/www", Port: 443, Auth: AuthConfig{Realm: "Staging"}}
+	assert.Equal(t, ValidationErrors{{Field: "Auth.Users", Message: "at least one user is required"}}, service.Validate())
+
+	service = Service{Selection: 1, Domains: "sidsun.com", Root: "/srv/www", Port: 443,
+		Locations: []Location{{Match: "regex", Path: `^/admin/`, Selection: 2, Root: "/srv/admin"}},
+		Auth:      AuthConfig{Users: []string{"sid"}, Path: `^/admin/`}}
+	assert.Equal(t, ValidationErrors{{Field: "Auth.Path", Message: `"^/admin/" is the path of a regex location, the regexes before it could answer its requests without credentials`}}, service.Validate())
+}
+
+func TestAuthLocationsUnderPath(t *testing.T) {
+	service := Service{Selection: 4, Domains: "sidsun.com", Root: "/srv/www", PHPBackend: "127.0.0.1:9000", Port: 443,
+		Locations: []Location{
+			{Path: "/admin/", Selection: 4, Root: "/srv/admin", PHPBackend: "127.0.0.1:9000"},
+			{Path: "/admin/uploads/", Selection: 2, Root: "/srv/uploads"},
+			{Match: "exact", Path: "/admin/health", Selection: 6, URL: "https://status.sidsun.com"},
+			{Path: "/public/", Selection: 2, Root: "/srv/public"},
+		},
+		Auth:       AuthConfig{Users: []string{"sid"}, Path: "/admin/"},
+		Additional: Additions{AddCachingConfig: true}}
+	assert.Empty(t, service.Validate())
+	_, contents := prepareServiceFileContents(service)
+	nodes, err := parseConfig([]byte(contents))
+	assert.NoError(t, err)
+	server := nodes[0].(*Directive)
+	protected := 0
+	for _, location := range server.findAll("location") {
+		args := location.Args
+		switch path := args[len(args)-1]; {
+		case args[0] == "~" || args[0] == "~*":
+			// The protected prefix is ^~, so regexes of the server are never matched under it
+		case strings.HasPrefix(path, "/admin/"):
+			assert.NotNil(t, location.find("auth_basic"), "location %s", strings.Join(args, " "))
+			protected++
+		default:
+			assert.Nil(t, location.find("auth_basic"), "location %s", strings.Join(args, " "))
+		}
+	}
+	assert.Equal(t, 3, protected)
+	assert.Contains(t, contents, "    location ^~ /admin/ {\n        auth_basic \"Restricted\";\n")
+	assert.Contains(t, contents, "location ~* \\.(")
+}
+
+func TestImportAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	userFile := filepath.Join(dir, "htpasswd")
+	assert.NoError(t, ioutil.WriteFile(userFile, []byte("sid:$apr1$saltsalt$FzqJUoU5ODlS7TVX9KiBy/\nsu:$apr1$ab$eIePjsejfBGR8ITtu2z0U1\n"), 0644))
+
+	for _, service := range []Service{
+		{Selection: 1, Domains: "staging.sidsun.com", Root: "/srv/www", Port: 443, Auth: AuthConfig{Users: []string{"sid", "su"}, UserFile: userFile}},
+		{Selection: 5, Domains: "staging.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443,
+			Locations: []Location{{Match: "exact", Path: "/admin", Selection: 2, Root: "/srv/admin"}},
+			Auth:      AuthConfig{Realm: "Admin", Users: []string{"sid", "su"}, UserFile: userFile, Path: "/admin"}},
+		{Selection: 5, Domains: "staging.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443,
+			Locations: []Location{{Match: "prefix", Path: "/admin/", Selection: 2, Root: "/srv/admin"}, {Match: "prefix", Path: "/admin/uploads/", Selection: 2, Root: "/srv/uploads"}},
+			Auth:      AuthConfig{Users: []string{"sid", "su"}, UserFile: userFile, Path: "/admin/"}},
+	} {
+		_, contents := prepareServiceFileContents(service)
+		nodes, err := parseConfig([]byte(contents))
+		assert.NoError(t, err)
+		results := importServerBlocks(nodes)
+		assert.Len(t, results, 1)
+		assert.Empty(t, results[0].Warnings)
+		assert.Equal(t, service, results[0].Service)
+	}
+
+	nodes, err := parseConfig([]byte("server {\n    listen 443;\n    server_name sidsun.com;\n    root /srv/www;\n    auth_basic \"Restricted\";\n    auth_basic_user_file /nonexistent/htpasswd;\n}\n"))
+	assert.NoError(t, err)
+	results := importServerBlocks(nodes)
+	assert.Len(t, results, 1)
+	assert.Equal(t, AuthConfig{UserFile: "/nonexistent/htpasswd"}, results[0].Service.Auth)
+	assert.Len(t, results[0].Warnings, 1)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// batchResult is the outcome of generating the config of one service file in a batch
+type batchResult struct {
+	Source   string
+	Output   string
+	Err      error
+	OutDated bool // Only set when checking
+	Configs  int  // Configs written, a file with [[service]] tables has one per service with Split
+}
+
+// isBatchSource reports whether arg names more than a single service file: a directory or a glob pattern
+func isBatchSource(arg string) bool {
+	if strings.ContainsAny(arg, "*?[") {
+		return true
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir()
+}
+
+// expandBatchSources turns directories into the TOML files directly inside them and expands glob patterns
+func expandBatchSources(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		pattern := arg
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			pattern = filepath.Join(arg, "*.toml")
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %s", arg, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no service files found for %s", arg)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// generateBatch renders every service file without asking, prints a summary and returns the exit code
+// Existing configs with other contents are only overwritten with overwriteForce, with Check nothing is written
+func generateBatch(paths []string, options outputOptions) int {
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		red.Println("Error occoured while creating", options.Dir, "Details:\n", err.Error())
+		return exitError
+	}
+	if options.Policy == overwriteAsk {
+		options.Policy = overwriteRefuse
+	}
+	results := make([]batchResult, 0, len(paths))
+	written := map[string]string{} // Output path to the service file it was generated from
+	for _, path := range paths {
+		result := batchResult{Source: path}
+		file, err := loadServiceFile(path)
+		if err == nil {
+			err = file.check(!options.SkipTLSCheck)
+		}
+		var configs []renderedConfig
+		if err == nil {
+			configs, err = file.render(options.Split)
+		}
+		var outputs []string
+		for i := 0; err == nil && i < len(configs); i++ {
+			output := filepath.Join(options.Dir, configs[i].FileName+".conf")
+			if source, ok := written[output]; ok {
+				if configs[i].FileName == websocketSnippetName {
+					continue // Shared by every service file proxying WebSockets
+				}
+				err = fmt.Errorf("%s was already generated from %s", output, source)
+				break
+			}
+			written[output] = path
+			outputs = append(outputs, output)
+			if options.Check {
+				var upToDate bool
+				upToDate, err = checkConfigFile(output, configs[i].Contents)
+				result.OutDated = result.OutDated || !upToDate
+			} else {
+				_, err = writeConfigFile(output, configs[i].Contents, options.Policy)
+			}
+			if err == nil {
+				result.Configs++
+			}
+		}
+		result.Output = strings.Join(outputs, ", ")
+		result.Err = err
+		results = append(results, result)
+	}
+	return printBatchSummary(results, options.Check)
+}
+
+func printBatchSummary(results []batchResult, check bool) int {
+	exitCode := exitOK
+	failed, configs := 0, 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "SERVICE FILE\tSTATUS\tDETAILS")
+	for _, result := range results {
+		if result.Err != nil {
+			_, _ = fmt.Fprintf(writer, "%s\tfailed\t%s\n", result.Source, strings.ReplaceAll(result.Err.Error(), "\n", " "))
+			exitCode = exitError
+			failed++
+			continue
+		}
+		if result.OutDated {
+			_, _ = fmt.Fprintf(writer, "%s\tout of date\t%s\n", result.Source, result.Output)
+			exitCode = exitError
+			failed++
+			continue
+		}
+		_, _ = fmt.Fprintf(writer, "%s\tok\t%s\n", result.Source, result.Output)
+		configs += result.Configs
+	}
+	_ = writer.Flush()
+	if failed > 0 {
+		_, _ = red.Printf("%d of %d service files failed or are out of date\n", failed, len(results))
+	} else if check {
+		fmt.Printf("All %d service files are up to date\n", len(results))
+	} else {
+		fmt.Printf("Generated %d configs from %d service files, move them to the appropriate config folder and reload the nginx webserver, Enjoy!\n", configs, len(results))
+	}
+	return exitCode
+}
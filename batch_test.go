@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	services := filepath.Join(dir, "services")
+	out := filepath.Join(dir, "out")
+	assert.NoError(t, os.Mkdir(services, 0755))
+	files := map[string]string{
+		"a.toml":     "Selection = 5\nDomains = \"a.com\"\nURL = \"http://127.0.0.1:8000\"\nPort = 443\n",
+		"b.toml":     "Selection = 1\nDomains = \"b.com\"\nRoot = \"/srv/www/b\"\nPort = 443\n",
+		"b-www.toml": "Selection = 6\nDomains = \"b.com\"\nURL = \"https://b.com\"\nPort = 80\n",
+		"c.toml":     "Selection = 2\nDomains = \"c.com\"\nPort = 443\n",
+		"notes.txt":  "not a service",
+	}
+	for name, contents := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(services, name), []byte(contents), 0644))
+	}
+
+	paths, err := expandBatchSources([]string{services})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(services, "a.toml"),
+		filepath.Join(services, "b-www.toml"),
+		filepath.Join(services, "b.toml"),
+		filepath.Join(services, "c.toml"),
+	}, paths)
+
+	assert.Equal(t, exitError, generateBatch(paths, outputOptions{Dir: out}))
+	written, _ := filepath.Glob(filepath.Join(out, "*"))
+	assert.Equal(t, []string{filepath.Join(out, "a.com.conf"), filepath.Join(out, "b.com.conf")}, written)
+
+	_, err = expandBatchSources([]string{filepath.Join(services, "*.yaml")})
+	assert.Error(t, err)
+	assert.True(t, isBatchSource(filepath.Join(services, "*.toml")))
+	assert.False(t, isBatchSource(filepath.Join(services, "a.toml")))
+}
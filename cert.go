@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+const caValidity time.Duration = 10 * 365 * 24 * time.Hour // Lifetime of a newly created local CA
+
+// certOptions configures where cert keeps the local CA and the certificates it issues
+type certOptions struct {
+	Dir        string // Certificates are written to Dir/<first name>.pem and Dir/<first name>.key
+	CADir      string // The local CA is read from or created as CADir/ca.pem and CADir/ca.key
+	SelfSigned bool   // Sign every certificate with its own key instead of the local CA
+	Validity   time.Duration
+}
+
+// issuedCertificate is a certificate written for the service at Index in its file
+type issuedCertificate struct {
+	Index       int
+	Names       []string
+	Certificate string
+	Key         string
+	Chain       string // Intermediates of certificates from an ACME CA, empty for the local CA
+}
+
+func runCert(args []string) int {
+	flags := newFlagSet("cert")
+	dir := flags.String("dir", "/etc/nginx/certs", "directory to write the certificates and keys to")
+	caDir := flags.String("ca-dir", "", "directory of the local CA, created when it doesn't hold one (default <dir>)")
+	selfSigned := flags.Bool("self-signed", false, "issue self-signed certificates instead of signing them with the local CA")
+	days := flags.Int("days", 825, "days the certificates are valid for")
+	noUpdate := flags.Bool("no-update", false, "don't point the service file at the issued certificates")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 || *days < 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	options := certOptions{Dir: getAbsolutePath(*dir), CADir: *caDir, SelfSigned: *selfSigned, Validity: time.Duration(*days) * 24 * time.Hour}
+	if options.CADir == "" {
+		options.CADir = options.Dir
+	}
+
+	path := flags.Arg(0)
+	file, err := loadServiceFile(path)
+	var issued []issuedCertificate
+	if err == nil {
+		issued, err = issueServiceCertificates(file, options)
+	}
+	if err == nil && !*noUpdate {
+		err = setServiceCertificates(path, file, issued)
+	}
+	if err != nil {
+		red.Println("Error occoured while issuing certificates for", path, "Details: \n", err.Error())
+		return exitError
+	}
+	for _, certificate := range issued {
+		fmt.Printf("Wrote certificate for %s to %s and its key to %s\n", strings.Join(certificate.Names, ", "), certificate.Certificate, certificate.Key)
+	}
+	if !*noUpdate {
+		fmt.Printf("Updated %s to use the certificates, backup written to %s\n", path, path+".bak")
+	}
+	if !options.SelfSigned {
+		_, _ = yellow.Printf("Clients have to trust the local CA at %s\n", filepath.Join(options.CADir, "ca.pem"))
+	}
+	return exitOK
+}
+
+// issueServiceCertificates writes a certificate for every HTTPS service in file
+func issueServiceCertificates(file serviceFile, options certOptions) ([]issuedCertificate, error) {
+	var caCertificate *x509.Certificate
+	var caKey crypto.Signer
+	if !options.SelfSigned {
+		var err error
+		if caCertificate, caKey, err = loadOrCreateCA(options.CADir); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, err
+	}
+	var issued []issuedCertificate
+	for i, server := range file.Services {
+		if server.Port != 443 && !server.Additional.TLS.configured() {
+			continue
+		}
+		names, err := certificateNames(server.Domains)
+		if err != nil {
+			return nil, fmt.Errorf("service[%d]: %s", i, err.Error())
+		}
+		certificatePEM, keyPEM, err := issueCertificate(names, caCertificate, caKey, options.Validity)
+		if err != nil {
+			return nil, err
+		}
+		certificate := issuedCertificate{
+			Index:       i,
+			Names:       names,
+			Certificate: filepath.Join(options.Dir, names[0]+".pem"),
+			Key:         filepath.Join(options.Dir, names[0]+".key"),
+		}
+		if err := writeKeyPair(certificate.Certificate, certificatePEM, certificate.Key, keyPEM); err != nil {
+			return nil, err
+		}
+		issued = append(issued, certificate)
+	}
+	if len(issued) == 0 {
+		return nil, fmt.Errorf("no service listens on 443 or has TLS configured")
+	}
+	return issued, nil
+}
+
+// certificateNames returns the DNS names and IPs a certificate for the server_name domains has to cover
+// .example.com matches example.com and its subdomains, so both are included
+func certificateNames(domains string) ([]string, error) {
+	var names []string
+	for _, domain := range strings.Fields(domains) {
+		switch {
+		case domain == "_":
+		case strings.HasPrefix(domain, "~") || strings.HasSuffix(domain, ".*"):
+			return nil, fmt.Errorf("a certificate can't be issued for %s", domain)
+		case strings.HasPrefix(domain, "."):
+			names = append(names, domain[1:], "*"+domain)
+		default:
+			names = append(names, domain)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no domains to issue a certificate for")
+	}
+	return names, nil
+}
+
+// writeKeyPair writes a PEM encoded certificate and its private key, which only the owner can read
+func writeKeyPair(certificatePath string, certificatePEM []byte, keyPath string, keyPEM []byte) error {
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	return writeContentToFile(certificatePath, certificatePEM)
+}
+
+// issueCertificate creates a server certificate for names signed by the CA, or self-signed when ca is nil
+// The certificate and its key are returned PEM encoded
+func issueCertificate(names []string, ca *x509.Certificate, caKey crypto.Signer, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certificateTemplate(names[0], validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	parent, signer := template, crypto.Signer(key)
+	if ca != nil {
+		parent, signer = ca, caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(der, key)
+}
+
+// loadOrCreateCA reads the local CA from dir, creating it when dir has none
+func loadOrCreateCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	certificatePath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+	if !fileExists(certificatePath) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		template, err := certificateTemplate("nginx-auto-config local CA", caValidity)
+		if err != nil {
+			return nil, nil, err
+		}
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		certificatePEM, keyPEM, err := encodeCertificate(der, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+		if err := writeKeyPair(certificatePath, certificatePEM, keyPath, keyPEM); err != nil {
+			return nil, nil, err
+		}
+		fmt.Printf("Created a local CA in %s\n", dir)
+	}
+
+	certificatePEM, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%s is not PEM encoded", certificatePath)
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !certificate.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA which can sign certificates", certificatePath)
+	}
+	key, err := readPrivateKey(keyPath)
+	return certificate, key, err
+}
+
+// readPrivateKey reads a PEM encoded PKCS #8 private key
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a signing key", path)
+	}
+	return signer, nil
+}
+
+func certificateTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour), // Tolerate clocks which are slightly behind
+		NotAfter:     time.Now().Add(validity),
+	}, nil
+}
+
+func encodeCertificate(der []byte, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// setServiceCertificates points the TLS of the services in the file at path at their issued certificates, keeping the
+// original as path.bak
+// Values the services inherit from [defaults] which would conflict are overridden in the service table
+func setServiceCertificates(path string, file serviceFile, issued []issuedCertificate) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return err
+	}
+	if _, err := migrateTree(tree); err != nil {
+		return err
+	}
+	tables := []*toml.Tree{tree}
+	if file.Multiple {
+		tables = tree.Get("service").([]*toml.Tree)
+	}
+	for _, certificate := range issued {
+		table, previous := tables[certificate.Index], file.Services[certificate.Index].Additional.TLS
+		table.SetPath([]string{"Additional", "TLS", "Certificate"}, certificate.Certificate)
+		table.SetPath([]string{"Additional", "TLS", "Key"}, certificate.Key)
+		if previous.LetsEncrypt {
+			table.SetPath([]string{"Additional", "TLS", "LetsEncrypt"}, false)
+		}
+		if previous.LiveDir != "" {
+			table.SetPath([]string{"Additional", "TLS", "LiveDir"}, "")
+		}
+		if certificate.Chain != "" || previous.Chain != "" {
+			table.SetPath([]string{"Additional", "TLS", "Chain"}, certificate.Chain)
+		}
+	}
+	updated, err := tree.ToTomlString()
+	if err != nil {
+		return err
+	}
+	if err := writeContentToFile(path+".bak", data); err != nil {
+		return err
+	}
+	return writeContentToFile(path, []byte(updated))
+}
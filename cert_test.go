@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertificateNames(t *testing.T) {
+	names, err := certificateNames("sidsun.com *.sidsun.com .sulabs.org 10.0.0.1 _")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sidsun.com", "*.sidsun.com", "sulabs.org", "*.sulabs.org", "10.0.0.1"}, names)
+
+	_, err = certificateNames("_")
+	assert.Error(t, err)
+	_, err = certificateNames("sidsun.com ~^www\\d+\\.sidsun\\.com$")
+	assert.Error(t, err)
+}
+
+func TestRunCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certs := filepath.Join(dir, "certs")
+	path := filepath.Join(dir, "app.toml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+[defaults]
+Port = 443
+[defaults.Additional.TLS]
+LetsEncrypt = true
+
+[[service]]
+Selection = 5
+Domains = "app.com *.app.com"
+URL = "http://127.0.0.1:8000"
+
+[[service]]
+Selection = 8
+Domains = "_"
+Port = 80
+[service.Additional.TLS]
+LetsEncrypt = false
+`), 0644))
+
+	verify := func(t *testing.T, certificatePath string, name string, roots *x509.CertPool) {
+		data, err := ioutil.ReadFile(certificatePath)
+		assert.NoError(t, err)
+		block, _ := pem.Decode(data)
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		assert.NoError(t, err)
+		_, err = certificate.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: time.Now()})
+		assert.NoError(t, err)
+	}
+
+	t.Run("test certificates signed by the local CA", func(t *testing.T) {
+		assert.Equal(t, exitOK, runCert([]string{"--dir", certs, path}))
+		caData, err := ioutil.ReadFile(filepath.Join(certs, "ca.pem"))
+		assert.NoError(t, err)
+		roots := x509.NewCertPool()
+		assert.True(t, roots.AppendCertsFromPEM(caData))
+		verify(t, filepath.Join(certs, "app.com.pem"), "app.com", roots)
+		verify(t, filepath.Join(certs, "app.com.pem"), "api.app.com", roots)
+
+		file, err := loadServiceFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, TLSConfig{Certificate: filepath.Join(certs, "app.com.pem"), Key: filepath.Join(certs, "app.com.key")}, file.Services[0].Additional.TLS)
+		assert.Equal(t, TLSConfig{}, file.Services[1].Additional.TLS)
+		assert.NoError(t, file.check(true))
+		assert.FileExists(t, path+".bak")
+
+		// The CA is reused for later certificates
+		assert.Equal(t, exitOK, runCert([]string{"--dir", certs, "--no-update", path}))
+		verify(t, filepath.Join(certs, "app.com.pem"), "app.com", roots)
+	})
+
+	t.Run("test self-signed certificate", func(t *testing.T) {
+		selfSigned := filepath.Join(dir, "self-signed")
+		assert.Equal(t, exitOK, runCert([]string{"--dir", selfSigned, "--self-signed", "--no-update", path}))
+		assert.False(t, fileExists(filepath.Join(selfSigned, "ca.pem")))
+		data, err := ioutil.ReadFile(filepath.Join(selfSigned, "app.com.pem"))
+		assert.NoError(t, err)
+		roots := x509.NewCertPool()
+		assert.True(t, roots.AppendCertsFromPEM(data))
+		verify(t, filepath.Join(selfSigned, "app.com.pem"), "www.app.com", roots)
+	})
+
+	t.Run("test service file without HTTPS services", func(t *testing.T) {
+		httpOnly := filepath.Join(dir, "default.toml")
+		assert.NoError(t, ioutil.WriteFile(httpOnly, []byte("Selection = 8\nDomains = \"_\"\nPort = 80\n"), 0644))
+		assert.Equal(t, exitError, runCert([]string{"--dir", certs, httpOnly}))
+	})
+}
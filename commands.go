@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes returned by commands
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a subcommand of the program, run returns the exit code
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+// Commands are registered in init as their help refers back to this list
+func init() {
+	commands = []command{
+		{"generate", "generate [flags] [service.toml | dir | glob...]", "Create configs from service TOML files or from flags", runGenerate},
+		{"validate", "validate service.toml...", "Check service TOML files without writing anything", runValidate},
+		{"import", "import [flags] nginx.conf...", "Create service TOML files from existing nginx configs", runImport},
+		{"diff", "diff [flags] service.toml | dir | glob...", "Show the difference between the generated configs and the ones on disk, exits with 1 when they differ", runDiff},
+		{"apply", "apply [flags] service.toml", "Install a config into sites-available/sites-enabled, test it and reload nginx, restoring the previous config on failure", runApply},
+		{"cert", "cert [flags] service.toml", "Issue certificates for the services from a local CA (or self-signed) and point the service file at them", runCert},
+		{"acme", "acme [flags] service.toml", "Obtain certificates for the services from an ACME CA like Let's Encrypt over HTTP-01, then install the config", runACME},
+		{"htpasswd", "htpasswd [flags] service.toml", "Create or update the htpasswd files of the services with basic authentication, asking for the passwords of Auth.Users", runHtpasswd},
+		{"migrate", "migrate service.toml...", "Update service TOML files to the current schema version, keeping a .bak backup", runMigrate},
+		{"presets", "presets", "List the available presets", runPresets},
+	}
+}
+
+// preset describes one of the server configurations the program can create
+type preset struct {
+	Selection   int
+	Name        string // Used with --preset
+	Title       string
+	Description string
+}
+
+var presets = []preset{
+	{1, "static", "Static website hosting", "Host a static website"},
+	{2, "files", "Host files without index", "Host files without an index"},
+	{3, "webapp", "Host a routed webapp", "Host a React/Angular/Vue webapp"},
+	{4, "php", "PHP Website hosting", "Host a PHP site with fastcgi and php-fpm"},
+	{5, "proxy", "Proxy requests", "Proxy incoming requests to a port or a website"},
+	{6, "redirect", "Permanent URL redirection", "Redirect all incoming requests to an address"},
+	{7, "proxy-port", "Proxy with custom port", "Proxy incoming requests at a port to an address"},
+	{8, "https-redirect", "HTTP requests to HTTPS redirect", "Redirects all incoming HTTP traffic to HTTPS (use as default config)"},
+	{9, "load-balance", "Load balanced proxy", "Proxy incoming requests to several backend servers"},
+	{10, "grpc", "gRPC proxy", "Proxy incoming gRPC calls over HTTP/2 to a grpc:// or grpcs:// backend"},
+	{11, "wsgi", "Python WSGI app hosting", "Host a Django/Flask app running on uwsgi or gunicorn with its static files"},
+	{12, "wordpress", "WordPress hosting", "Host a WordPress site on php-fpm with hardened defaults and cached assets"},
+}
+
+func presetByName(name string) (preset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return preset{}, false
+}
+
+func presetBySelection(selection int) (preset, bool) {
+	for _, p := range presets {
+		if p.Selection == selection {
+			return p, true
+		}
+	}
+	return preset{}, false
+}
+
+func presetNameList() string {
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// runCLI dispatches the arguments to the wizard or a command, returns the exit code
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		return runWizard()
+	}
+	switch pArg := args[0]; {
+	case pArg == "-h" || pArg == "-help" || pArg == "--help" || pArg == "help":
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				return cmd.run([]string{"-h"})
+			}
+		}
+		printUsage()
+		return exitOK
+	case pArg == "-v" || pArg == "-version" || pArg == "--version":
+		fmt.Println(version)
+		return exitOK
+	case strings.HasPrefix(pArg, "-"):
+		// Service flags without a command are kept as an alias for generate
+		return runGenerate(args)
+	}
+	if cmd, ok := findCommand(args[0]); ok {
+		return cmd.run(args[1:])
+	}
+	if fileExists(args[0]) || isBatchSource(args[0]) {
+		// nginx-auto-config service.toml is kept as an alias for generate
+		return runGenerate(args)
+	}
+	red.Printf("Unknown command: %s\n", args[0])
+	fmt.Println("Run with -h, -help or --help to get help")
+	return exitUsage
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage() {
+	fmt.Println("nginx-auto-config is a program which allows you to create configurations for the nginx web server using a number of presets interactively\nLicensed under the MIT license, created by Sidharth Soni (Sid Sun)\nYou can find the source code at: https://github.com/Sid-Sun/nginx-auto-config")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  nginx-auto-config                 launch the program interactively")
+	fmt.Println("  nginx-auto-config <command> [arguments]")
+	fmt.Println("  nginx-auto-config service.toml    same as generate service.toml")
+	fmt.Println()
+	fmt.Println("Commands:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(writer, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	_ = writer.Flush()
+	fmt.Println()
+	fmt.Println("Run nginx-auto-config help <command> for the flags of a command")
+	fmt.Println("-v, -version or --version to get program version")
+	fmt.Println("Exit codes: 0 on success, 1 when the command failed, 2 on invalid usage")
+}
+
+// newFlagSet creates the flag set of a command with its usage message as help
+func newFlagSet(name string) *flag.FlagSet {
+	cmd, _ := findCommand(name)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nginx-auto-config %s\n\n%s\n", cmd.usage, cmd.summary)
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(flags.Output(), "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parseFlags parses args, the returned exit code is only meaningful when ok is false
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+func runPresets(args []string) int {
+	flags := newFlagSet("presets")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "SELECTION\tNAME\tDESCRIPTION")
+	for _, p := range presets {
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s - %s\n", p.Selection, p.Name, p.Title, p.Description)
+	}
+	_ = writer.Flush()
+	return exitOK
+}
+
+func runValidate(args []string) int {
+	flags := newFlagSet("validate")
+	skipTLSCheck := flags.Bool("skip-tls-check", false, "don't check that the certificate files exist and match")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	exitCode := exitOK
+	for _, path := range flags.Args() {
+		file, err := loadServiceFile(path)
+		if err == nil {
+			err = file.check(!*skipTLSCheck)
+		}
+		if errs, ok := err.(ValidationErrors); ok {
+			for _, fieldError := range errs {
+				_, _ = red.Printf("%s: %s\n", path, fieldError.Error())
+			}
+			exitCode = exitError
+			continue
+		} else if err != nil {
+			_, _ = red.Printf("%s: %s\n", path, err.Error())
+			exitCode = exitError
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	return exitCode
+}
+
+func runImport(args []string) int {
+	flags := newFlagSet("import")
+	out := flags.String("out", ".", "directory to write the service TOML files to")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	return importFiles(flags.Args(), *out)
+}
+
+func runMigrate(args []string) int {
+	flags := newFlagSet("migrate")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	exitCode := exitOK
+	for _, path := range flags.Args() {
+		fileVersion, err := migrateFile(path)
+		if err != nil {
+			_, _ = red.Printf("%s: %s\n", path, err.Error())
+			exitCode = exitError
+			continue
+		}
+		if fileVersion == schemaVersion {
+			fmt.Printf("%s: already at SchemaVersion %d\n", path, schemaVersion)
+			continue
+		}
+		fmt.Printf("%s: migrated from SchemaVersion %d to %d, backup written to %s\n", path, fileVersion, schemaVersion, path+".bak")
+	}
+	return exitCode
+}
+
+func runDiff(args []string) int {
+	flags := newFlagSet("diff")
+	out := flags.String("out", ".", "directory the configs were written to")
+	split := flags.Bool("split", false, "compare one config per service for files with [[service]] tables")
+	skipTLSCheck := flags.Bool("skip-tls-check", false, "don't check that the certificate files exist and match")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	options := outputOptions{Dir: *out, Split: *split, Check: true, SkipTLSCheck: *skipTLSCheck}
+	if flags.NArg() == 1 && !isBatchSource(flags.Arg(0)) {
+		return generateFromFile(flags.Arg(0), options, true)
+	}
+	paths, err := expandBatchSources(flags.Args())
+	if err != nil {
+		red.Println(err.Error())
+		return exitError
+	}
+	return generateBatch(paths, options)
+}
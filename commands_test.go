@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.toml")
+	invalid := filepath.Join(dir, "invalid.toml")
+	assert.NoError(t, ioutil.WriteFile(valid, []byte("Selection = 5\nDomains = \"a.com\"\nURL = \"http://127.0.0.1:8000\"\nPort = 443\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("Selection = 12\nDomains = \"a.com\"\nPort = 443\n"), 0644))
+
+	testCases := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+	}{
+		{"test version", []string{"--version"}, exitOK},
+		{"test help", []string{"-h"}, exitOK},
+		{"test command help", []string{"help", "generate"}, exitOK},
+		{"test presets", []string{"presets"}, exitOK},
+		{"test validate valid file", []string{"validate", valid}, exitOK},
+		{"test validate invalid file", []string{"validate", valid, invalid}, exitError},
+		{"test validate without files", []string{"validate"}, exitUsage},
+		{"test generate file alias", []string{invalid}, exitError},
+		{"test unknown command", []string{"deploy"}, exitUsage},
+		{"test unknown flag", []string{"generate", "--nope"}, exitUsage},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedExitCode, runCLI(testCase.args))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import "strings"
+
+const indentUnit string = "    " // Indentation used for every nesting level of the printed config
+
+// Node is a single element of an nginx config: a Directive or a Comment
+type Node interface {
+	print(b *strings.Builder, indent string)
+}
+
+// Comment is a comment on a line of its own, the text does not include the leading #
+type Comment string
+
+// Directive is an nginx directive (ex: listen 443 ssl;), it is a block directive (ex: server, location) when Block is non-nil
+type Directive struct {
+	Name      string
+	Args      []string
+	Block     []Node
+	Commented bool   // Printed prefixed with # so nginx ignores it
+	Separator string // Printed between the name and the arguments, a single space when empty
+	Line      int    // Line the directive starts on when parsed from a file
+}
+
+func newDirective(name string, args ...string) *Directive {
+	return &Directive{Name: name, Args: args}
+}
+
+func newBlock(name string, args ...string) *Directive {
+	return &Directive{Name: name, Args: args, Block: []Node{}}
+}
+
+func (d *Directive) isBlock() bool {
+	return d.Block != nil
+}
+
+// add appends nodes to the block and returns it so calls can be chained
+func (d *Directive) add(nodes ...Node) *Directive {
+	if d.Block == nil {
+		d.Block = []Node{}
+	}
+	d.Block = append(d.Block, nodes...)
+	return d
+}
+
+// find returns the first active (not commented) child directive with the given name
+func (d *Directive) find(name string) *Directive {
+	for _, child := range d.findAll(name) {
+		return child
+	}
+	return nil
+}
+
+// findAll returns every active (not commented) child directive with the given name, in order
+func (d *Directive) findAll(name string) []*Directive {
+	var found []*Directive
+	for _, node := range d.Block {
+		if child, ok := node.(*Directive); ok && !child.Commented && child.Name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+func (c Comment) print(b *strings.Builder, indent string) {
+	b.WriteString(indent + "#" + string(c) + "\n")
+}
+
+func (d *Directive) print(b *strings.Builder, indent string) {
+	b.WriteString(indent)
+	if d.Commented {
+		b.WriteString("#")
+	}
+	b.WriteString(d.Name)
+	if len(d.Args) > 0 {
+		if d.Separator == "" {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(d.Separator)
+		}
+		b.WriteString(strings.Join(d.Args, " "))
+	}
+	if !d.isBlock() {
+		b.WriteString(";\n")
+		return
+	}
+	b.WriteString(" {\n")
+	for _, child := range d.Block {
+		child.print(b, indent+indentUnit)
+	}
+	b.WriteString(indent + "}\n")
+}
+
+// printConfig serialises nodes to nginx syntax, top level blocks after the first are separated by an empty line
+func printConfig(nodes ...Node) string {
+	var b strings.Builder
+	for i, node := range nodes {
+		if directive, ok := node.(*Directive); ok && directive.isBlock() && i > 0 {
+			b.WriteString("\n")
+		}
+		node.print(&b, "")
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrintConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		nodes    []Node
+		expected string
+	}{
+		{
+			name: "test print nested blocks with comments and commented directives",
+			nodes: []Node{
+				newBlock("server").add(
+					&Directive{Name: "listen", Args: []string{"443", "ssl"}, Commented: true},
+					Comment("Serve files"),
+					newBlock("location", "/").add(
+						newDirective("root", "/srv/www"),
+					),
+				),
+			},
+			expected: `server {
+    #listen 443 ssl;
+    #Serve files
+    location / {
+        root /srv/www;
+    }
+}
+`,
+		},
+		{
+			name: "test print directive with custom separator and empty block",
+			nodes: []Node{
+				newBlock("events"),
+				&Directive{Name: "worker_processes", Args: []string{"auto"}, Separator: "  "},
+			},
+			expected: `events {
+}
+worker_processes  auto;
+`,
+		},
+		{
+			name: "test print multiple top level blocks",
+			nodes: []Node{
+				newBlock("upstream", "app").add(newDirective("server", "127.0.0.1:8000")),
+				newBlock("server").add(newDirective("listen", "80")),
+			},
+			expected: `upstream app {
+    server 127.0.0.1:8000;
+}
+
+server {
+    listen 80;
+}
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, printConfig(testCase.nodes...))
+		})
+	}
+}
+
+func TestDirectiveFind(t *testing.T) {
+	block := newBlock("server").add(
+		&Directive{Name: "listen", Args: []string{"443"}, Commented: true},
+		newDirective("listen", "80"),
+		newDirective("listen", "[::]:80"),
+		Comment("listen 8080"),
+	)
+	assert.Equal(t, []string{"80"}, block.find("listen").Args)
+	assert.Len(t, block.findAll("listen"), 2)
+	assert.Nil(t, block.find("root"))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const diffContext int = 3 // Unchanged lines shown around every change
+
+// overwritePolicy decides what happens when a config exists on disk with other contents
+type overwritePolicy int
+
+const (
+	overwriteAsk    overwritePolicy = iota // Show the diff and ask before writing
+	overwriteRefuse                        // Show the diff and fail, used where stdin can't be read
+	overwriteForce                         // Show the diff and write
+)
+
+// diffLine is a line of an edit script, Kind is ' ' for unchanged, '-' for removed and '+' for added lines
+type diffLine struct {
+	Kind byte
+	Text string
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes the shortest edit script turning old into new using their longest common subsequence
+func diffLines(old []string, new []string) []diffLine {
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var script []diffLine
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			script = append(script, diffLine{' ', old[i]})
+			i++
+			j++
+		case j == len(new) || (i < len(old) && common[i+1][j] >= common[i][j+1]):
+			script = append(script, diffLine{'-', old[i]})
+			i++
+		default:
+			script = append(script, diffLine{'+', new[j]})
+			j++
+		}
+	}
+	return script
+}
+
+// unifiedDiff returns the lines of a unified diff between old and new, nil when they are equal
+func unifiedDiff(oldName string, newName string, old string, new string) []string {
+	if old == new {
+		return nil
+	}
+	script := diffLines(splitLines(old), splitLines(new))
+	output := []string{"--- " + oldName, "+++ " + newName}
+	oldLine, newLine := 1, 1 // Line numbers at the start of script[i]
+	for i := 0; i < len(script); {
+		if script[i].Kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// Start the hunk diffContext lines before this change and extend it while changes are close together
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for unchanged := 0; end < len(script) && unchanged <= 2*diffContext; end++ {
+			if script[end].Kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > i && script[end-1].Kind == ' ' {
+			end--
+		}
+		if end += diffContext; end > len(script) {
+			end = len(script)
+		}
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		var lines []string
+		for _, line := range script[start:end] {
+			if line.Kind != '+' {
+				oldCount++
+			}
+			if line.Kind != '-' {
+				newCount++
+			}
+			lines = append(lines, string(line.Kind)+line.Text)
+		}
+		output = append(output, fmt.Sprintf("@@ -%s +%s @@", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount)))
+		output = append(output, lines...)
+		for _, line := range script[i:end] {
+			if line.Kind != '+' {
+				oldLine++
+			}
+			if line.Kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return output
+}
+
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		start-- // Empty ranges point at the line before them
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// printDiff shows a unified diff with removed lines in red and added lines in cyan
+func printDiff(lines []string) {
+	for i, line := range lines {
+		switch {
+		case i < 2:
+			fmt.Println(line)
+		case strings.HasPrefix(line, "@@"):
+			_, _ = yellow.Println(line)
+		case strings.HasPrefix(line, "-"):
+			_, _ = red.Println(line)
+		case strings.HasPrefix(line, "+"):
+			_, _ = cyan.Println(line)
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+// readExisting returns the contents of path and whether it exists
+func readExisting(path string) (string, bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	return string(data), err == nil, err
+}
+
+// writeConfigFile writes contents to path, when path already holds other contents the diff is shown and the policy
+// decides whether to write, returns whether path holds contents afterwards
+func writeConfigFile(path string, contents string, policy overwritePolicy) (bool, error) {
+	existing, exists, err := readExisting(path)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		if existing == contents {
+			fmt.Printf("%s is up to date\n", path)
+			return true, nil
+		}
+		printDiff(unifiedDiff(path, path+" (generated)", existing, contents))
+		switch policy {
+		case overwriteRefuse:
+			return false, fmt.Errorf("%s already exists with different contents, use --force to overwrite it", path)
+		case overwriteAsk:
+			_, _ = cyan.Printf("Overwrite %s? (y[es]/N[o]): ", path)
+			if !getConsent(false) {
+				return false, nil
+			}
+		}
+	}
+	return true, writeContentToFile(path, []byte(contents))
+}
+
+// checkConfigFile shows the diff between path and contents, returns whether path is up to date
+func checkConfigFile(path string, contents string) (bool, error) {
+	existing, exists, err := readExisting(path)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		_, _ = red.Printf("%s does not exist\n", path)
+		return false, nil
+	}
+	lines := unifiedDiff(path, path+" (generated)", existing, contents)
+	printDiff(lines)
+	return lines == nil, nil
+}
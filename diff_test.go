@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "test equal contents",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "test changes far apart make separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			expected: `--- old
++++ new
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13`,
+		},
+		{
+			name: "test new file",
+			old:  "",
+			new:  "server {\n}\n",
+			expected: `--- old
++++ new
+@@ -0,0 +1,2 @@
++server {
++}`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, strings.Join(unifiedDiff("old", "new", testCase.old, testCase.new), "\n"))
+		})
+	}
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.com.conf")
+
+	written, err := writeConfigFile(path, "server {}\n", overwriteRefuse)
+	assert.NoError(t, err)
+	assert.True(t, written)
+	upToDate, err := checkConfigFile(path, "server {}\n")
+	assert.NoError(t, err)
+	assert.True(t, upToDate)
+
+	written, err = writeConfigFile(path, "server { listen 80; }\n", overwriteRefuse)
+	assert.Error(t, err)
+	assert.False(t, written)
+	upToDate, err = checkConfigFile(path, "server { listen 80; }\n")
+	assert.NoError(t, err)
+	assert.False(t, upToDate)
+
+	written, err = writeConfigFile(path, "server { listen 80; }\n", overwriteForce)
+	assert.NoError(t, err)
+	assert.True(t, written)
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "server { listen 80; }\n", string(contents))
+
+	upToDate, err = checkConfigFile(filepath.Join(dir, "missing.conf"), "server {}\n")
+	assert.NoError(t, err)
+	assert.False(t, upToDate)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Flags describing the service itself, these can't be combined with a service file
+var serviceFlags = []string{"preset", "domains", "root", "php-backend", "url", "wsgi-server", "wsgi-socket", "static", "media", "port", "hsts", "security", "default-server", "cache", "cache-age",
+	"tls-cert", "tls-key", "tls-chain", "letsencrypt", "letsencrypt-dir", "tls-profile", "tls-resolver",
+	"redirect-http", "challenge-webroot", "canonical-host", "backend", "balance", "hash-key",
+	"keepalive", "forward-headers", "proxy-connect-timeout", "proxy-send-timeout", "proxy-read-timeout", "disable-buffering", "max-body-size",
+	"websocket", "websocket-path", "location", "auth-user", "auth-realm", "auth-file", "auth-path"}
+
+// fieldFlags maps Service field paths to the flags setting them
+var fieldFlags = map[string]string{
+	"Selection":                   "--preset",
+	"Domains":                     "--domains",
+	"CanonicalHost":               "--canonical-host",
+	"Root":                        "--root",
+	"PHPBackend":                  "--php-backend",
+	"URL":                         "--url",
+	"WSGI":                        "--wsgi-socket",
+	"WSGI.Server":                 "--wsgi-server",
+	"WSGI.Socket":                 "--wsgi-socket",
+	"WSGI.Static":                 "--static",
+	"WSGI.Media":                  "--media",
+	"Upstream":                    "--backend",
+	"Upstream.Method":             "--balance",
+	"Upstream.HashKey":            "--hash-key",
+	"Upstream.Servers":            "--backend",
+	"Upstream.Keepalive":          "--keepalive",
+	"Proxy.ForwardHeaders":        "--forward-headers",
+	"Proxy.ConnectTimeout":        "--proxy-connect-timeout",
+	"Proxy.SendTimeout":           "--proxy-send-timeout",
+	"Proxy.ReadTimeout":           "--proxy-read-timeout",
+	"Proxy.DisableBuffering":      "--disable-buffering",
+	"Proxy.MaxBodySize":           "--max-body-size",
+	"Proxy.WebSocket":             "--websocket",
+	"Proxy.WebSocketPaths":        "--websocket-path",
+	"Locations":                   "--location",
+	"Auth":                        "--auth-user",
+	"Auth.Realm":                  "--auth-realm",
+	"Auth.Users":                  "--auth-user",
+	"Auth.UserFile":               "--auth-file",
+	"Auth.Path":                   "--auth-path",
+	"Port":                        "--port",
+	"Additional.AddCachingConfig": "--cache",
+	"Additional.MaxCacheAge":      "--cache-age",
+	"Additional.TLS.Certificate":  "--tls-cert",
+	"Additional.TLS.Key":          "--tls-key",
+	"Additional.TLS.Chain":        "--tls-chain",
+	"Additional.TLS.LetsEncrypt":  "--letsencrypt",
+	"Additional.TLS.LiveDir":      "--letsencrypt-dir",
+	"Additional.TLS.Profile":      "--tls-profile",
+	"Additional.TLS.Resolver":     "--tls-resolver",
+	"Additional.RedirectHTTP":     "--redirect-http",
+	"Additional.ChallengeWebroot": "--challenge-webroot",
+}
+
+// fieldFlag returns the flag setting the field at path, the path itself for fields set by several flags like Proxy
+func fieldFlag(path string) string {
+	if flag, ok := fieldFlags[path]; ok {
+		return flag
+	}
+	return path
+}
+
+// outputOptions controls where and how generated configs are written
+type outputOptions struct {
+	Dir    string
+	Split  bool            // One config per service for files with [[service]] tables
+	Policy overwritePolicy // What to do when a config exists with other contents
+	Check  bool            // Only compare with the configs on disk, nothing is written
+	// Don't check that the certificate files exist and match, for configs generated away from the server
+	SkipTLSCheck bool
+}
+
+// stringFlags collects a repeatable string flag
+type stringFlags []string
+
+func (values *stringFlags) String() string {
+	return strings.Join(*values, ", ")
+}
+
+func (values *stringFlags) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+// runGenerate creates a config from service TOML files or from flags, returns the exit code
+// With flags stdin is never read and nothing is written without --yes
+// Several files, a directory or a glob pattern are generated in one batch without asking
+func runGenerate(args []string) int {
+	flags := newFlagSet("generate")
+	presetName := flags.String("preset", "", "preset to use: "+presetNameList())
+	domains := flags.String("domains", "", "domain/sub-domain name(s) separated by space")
+	canonicalHost := flags.String("canonical-host", "", "one of the domains to redirect the others to")
+	root := flags.String("root", "", "root path of the files to serve")
+	phpBackend := flags.String("php-backend", "", "PHP-FPM of the php and wordpress presets: unix:/path socket or host:port (default "+defaultPHPSocket+")")
+	url := flags.String("url", "", "resource to proxy or redirect to, grpc:// or grpcs:// backend for grpc")
+	wsgiServer := flags.String("wsgi-server", "", "application server of wsgi: "+strings.Join(wsgiServers, ", ")+" (default uwsgi)")
+	wsgiSocket := flags.String("wsgi-socket", "", "unix:/path socket or host:port the application server of wsgi listens on")
+	static := flags.String("static", "", "directory wsgi serves /static/ from")
+	media := flags.String("media", "", "directory wsgi serves /media/ from")
+	var backends backendFlags
+	flags.Var(&backends, "backend", "backend server of load-balance with its parameters, ex: \"127.0.0.1:8000 weight=2 backup\" (repeatable)")
+	balance := flags.String("balance", "", "balancing method of load-balance: "+strings.Join(upstreamMethods, ", ")+" (default round-robin)")
+	hashKey := flags.String("hash-key", "", "key the hash balancing method uses, ex: $request_uri")
+	keepalive := flags.Int("keepalive", 0, "idle connections to the backends of load-balance each worker keeps open")
+	forwardHeaders := flags.Bool("forward-headers", true, "send the "+forwardedHeaderNames()+" headers to the backend of the proxy presets")
+	proxyConnectTimeout := flags.String("proxy-connect-timeout", "", "timeout for connecting to the backend, ex: 30s (default 60s)")
+	proxySendTimeout := flags.String("proxy-send-timeout", "", "timeout between two writes to the backend, ex: 30s (default 60s, 1h for grpc)")
+	proxyReadTimeout := flags.String("proxy-read-timeout", "", "timeout between two reads from the backend, ex: 5m (default 90s, 1h for grpc)")
+	disableBuffering := flags.Bool("disable-buffering", false, "pass responses of the backend to the client as they arrive")
+	maxBodySize := flags.String("max-body-size", "", "largest request body passed to the backend, ex: 10m (default 1m)")
+	websocket := flags.Bool("websocket", false, "pass WebSocket upgrades through to the backend for all requests")
+	var websocketPaths stringFlags
+	flags.Var(&websocketPaths, "websocket-path", "pass WebSocket upgrades through for this path only, ex: /socket.io/ (repeatable)")
+	var locations locationFlags
+	flags.Var(&locations, "location", "route a path to another preset: <prefix|exact|regex> <path> <preset> <root or url>, ex: \"prefix /api/ proxy http://127.0.0.1:8000\" (repeatable)")
+	var authUsers stringFlags
+	flags.Var(&authUsers, "auth-user", "ask for the credentials of this user with HTTP basic authentication, set the passwords with htpasswd (repeatable)")
+	authRealm := flags.String("auth-realm", "", "realm shown when asking for the credentials (default "+defaultAuthRealm+")")
+	authFile := flags.String("auth-file", "", "htpasswd file of the users (default "+defaultHtpasswdDir+"/<first domain>)")
+	authPath := flags.String("auth-path", "", "only ask for the credentials at the --location with this path")
+	port := flags.Int("port", 0, "port to listen on (default 443, 80 for https-redirect)")
+	hsts := flags.Bool("hsts", false, "send HSTS preload header")
+	security := flags.Bool("security", false, "add additional security options")
+	defaultServer := flags.Bool("default-server", false, "make the virtual server the default server")
+	cache := flags.Bool("cache", false, "leverage caching of static assets")
+	cacheAge := flags.String("cache-age", "", "cache expiry, ex: 1m/4h/2d/1y (default 6h, implies --cache)")
+	tlsCert := flags.String("tls-cert", "", "certificate with its intermediates, enables SSL")
+	tlsKey := flags.String("tls-key", "", "private key of the certificate")
+	tlsChain := flags.String("tls-chain", "", "intermediate and root certificates used for OCSP stapling")
+	letsEncrypt := flags.Bool("letsencrypt", false, "use the certificate certbot keeps for the first domain, enables SSL")
+	letsEncryptDir := flags.String("letsencrypt-dir", "", "directory certbot keeps the certificates in (default "+defaultLetsEncryptDir+")")
+	tlsProfile := flags.String("tls-profile", "", "Mozilla SSL profile: "+tlsProfileNameList())
+	tlsResolver := flags.String("tls-resolver", "", "resolver used for OCSP stapling with --tls-profile (default "+defaultResolver+")")
+	redirectHTTP := flags.Bool("redirect-http", false, "add a port 80 server block redirecting the domains to https")
+	challengeWebroot := flags.String("challenge-webroot", "", "serve /.well-known/acme-challenge/ from this directory in the --redirect-http block")
+	yes := flags.Bool("yes", false, "write the config without asking")
+	out := flags.String("out", ".", "directory to write the config to")
+	split := flags.Bool("split", false, "write one config per service for files with [[service]] tables")
+	force := flags.Bool("force", false, "overwrite existing configs with other contents without asking")
+	check := flags.Bool("check", false, "only compare with the existing configs, exits with 1 when any is out of date")
+	skipTLSCheck := flags.Bool("skip-tls-check", false, "don't check that the certificate files exist and match")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	options := outputOptions{Dir: *out, Split: *split, Policy: overwriteRefuse, Check: *check, SkipTLSCheck: *skipTLSCheck}
+	if *force {
+		options.Policy = overwriteForce
+	}
+	if flags.NArg() > 0 {
+		usedServiceFlag := ""
+		flags.Visit(func(f *flag.Flag) {
+			if inStrings(f.Name, serviceFlags) {
+				usedServiceFlag = f.Name
+			}
+		})
+		if usedServiceFlag != "" {
+			red.Printf("--%s can not be combined with a service file\n", usedServiceFlag)
+			return exitUsage
+		}
+		if flags.NArg() == 1 && !isBatchSource(flags.Arg(0)) {
+			if !*yes && !*force {
+				options.Policy = overwriteAsk
+			}
+			return generateFromFile(flags.Arg(0), options, *yes)
+		}
+		paths, err := expandBatchSources(flags.Args())
+		if err != nil {
+			red.Println(err.Error())
+			return exitError
+		}
+		return generateBatch(paths, options)
+	}
+
+	if *presetName == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	selected, ok := presetByName(*presetName)
+	if !ok {
+		red.Printf("Unknown preset: %q, available presets: %s\n", *presetName, presetNameList())
+		return exitUsage
+	}
+	server := Service{
+		Selection:     selected.Selection,
+		Domains:       strings.Join(strings.Fields(*domains), " "),
+		CanonicalHost: *canonicalHost,
+		Root:          *root,
+		PHPBackend:    *phpBackend,
+		URL:           *url,
+		WSGI:          WSGIConfig{Server: *wsgiServer, Socket: *wsgiSocket, Static: *static, Media: *media},
+		Upstream:      Upstream{Method: *balance, HashKey: *hashKey, Servers: backends, Keepalive: *keepalive},
+		Locations:     locations,
+		Auth:          AuthConfig{Realm: *authRealm, Users: authUsers, UserFile: *authFile, Path: *authPath},
+		Port:          443,
+		Additional: Additions{
+			AddHSTSConfig:     *hsts,
+			AddSecurityConfig: *security,
+			MakeDefaultServer: *defaultServer,
+			AddCachingConfig:  *cache || *cacheAge != "",
+			MaxCacheAge:       *cacheAge,
+			RedirectHTTP:      *redirectHTTP,
+			ChallengeWebroot:  *challengeWebroot,
+			TLS: TLSConfig{
+				Certificate: *tlsCert,
+				Key:         *tlsKey,
+				Chain:       *tlsChain,
+				LetsEncrypt: *letsEncrypt,
+				LiveDir:     *letsEncryptDir,
+				Profile:     *tlsProfile,
+				Resolver:    *tlsResolver,
+			},
+		},
+	}
+	if server.Selection == 7 {
+		server.Port = 0 // Custom port presets have no default
+	}
+	// The proxy flags are kept for every preset so Validate rejects them where they aren't used, only the default of
+	// --forward-headers is left out of the presets without proxy_pass
+	forwardHeadersSet := false
+	flags.Visit(func(f *flag.Flag) {
+		forwardHeadersSet = forwardHeadersSet || f.Name == "forward-headers"
+	})
+	server.Proxy = ProxyConfig{
+		ForwardHeaders:   *forwardHeaders && (inRange(server.Selection, []int{5, 7, 9}) || forwardHeadersSet),
+		ConnectTimeout:   *proxyConnectTimeout,
+		SendTimeout:      *proxySendTimeout,
+		ReadTimeout:      *proxyReadTimeout,
+		DisableBuffering: *disableBuffering,
+		MaxBodySize:      *maxBodySize,
+		WebSocket:        *websocket,
+		WebSocketPaths:   websocketPaths,
+	}
+	if server.Selection == 8 {
+		server.Additional.MakeDefaultServer = true
+		server.Domains = "_"
+		server.Port = 80
+	}
+	if *port != 0 {
+		server.Port = *port
+	}
+	err := server.Validate()
+	if err == nil && !options.SkipTLSCheck {
+		err = verifyTLSFiles(server)
+	}
+	if err != nil {
+		for _, fieldError := range err.(ValidationErrors) {
+			red.Printf("%s: %s\n", fieldFlag(fieldError.Field), fieldError.Message)
+		}
+		return exitUsage
+	}
+
+	fileName, fileContents := prepareServiceFileContents(server)
+	if options.Check {
+		configs := []renderedConfig{{fileName, fileContents}}
+		if server.usesWebSocket() {
+			configs = append(configs, websocketSnippet())
+		}
+		return checkConfigs(configs, options.Dir)
+	}
+	fmt.Print(fileContents)
+	if !*yes {
+		_, _ = yellow.Println("Nothing written, run with --yes to write the config")
+		return exitOK
+	}
+	tomlPath, confPath, written, err := saveService(options.Dir, fileName, server, fileContents, options.Policy)
+	if err != nil {
+		red.Println("Error occoured while writing config. Details:\n", err.Error())
+		return exitError
+	}
+	if !written {
+		return exitOK
+	}
+	fmt.Printf("Wrote service details to %s and config to %s\n", tomlPath, confPath)
+	if server.usesWebSocket() {
+		if err := saveWebSocketSnippet(options.Dir, options.Policy); err != nil {
+			red.Println("Error occoured while writing config. Details:\n", err.Error())
+			return exitError
+		}
+	}
+	if server.usesPlaceholderSSL() {
+		printCautionSSL()
+	}
+	return exitOK
+}
+
+// generateFromFile renders the services in a TOML file, asking for confirmation unless yes is set
+func generateFromFile(path string, options outputOptions, yes bool) int {
+	file, err := loadServiceFile(path)
+	if err == nil {
+		err = file.check(!options.SkipTLSCheck)
+	}
+	var configs []renderedConfig
+	if err == nil {
+		configs, err = file.render(options.Split)
+	}
+	if err != nil {
+		red.Println("Error occoured while reading config from", path, "Details: \n", err.Error())
+		return exitError
+	}
+	if options.Check {
+		return checkConfigs(configs, options.Dir)
+	}
+
+	for _, config := range configs {
+		fmt.Print(config.Contents)
+	}
+	if file.SchemaVersion < schemaVersion {
+		_, _ = yellow.Printf("%s uses SchemaVersion %d, run nginx-auto-config migrate %s to update it to %d\n", path, file.SchemaVersion, path, schemaVersion)
+	}
+	if !yes {
+		_, _ = cyan.Print("Is this correct? (Y[es]/n[o]): ")
+		if !getConsent(true) {
+			return exitOK
+		}
+	}
+
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		red.Println("Error occoured while creating", options.Dir, "Details:\n", err.Error())
+		return exitError
+	}
+	for _, config := range configs {
+		confPath := filepath.Join(options.Dir, config.FileName+".conf")
+		written, err := writeConfigFile(confPath, config.Contents, options.Policy)
+		if err != nil {
+			red.Println("Error occoured while writing config", confPath, "Details:\n", err.Error())
+			return exitError
+		}
+		if !written {
+			continue
+		}
+		fmt.Printf("Config written to %s, move it to the appropriate config folder and reload the nginx webserver, Enjoy!\n", confPath)
+	}
+	if file.usesPlaceholderSSL() {
+		printCautionSSL()
+	}
+	return exitOK
+}
+
+// saveService writes the rendered config and the service TOML to dir, returns the paths and whether they were written
+// The TOML is only written along with the config, policy decides what happens when the config exists with other contents
+func saveService(dir string, fileName string, server Service, fileContents string, policy overwritePolicy) (string, string, bool, error) {
+	tomlPath := filepath.Join(dir, fileName+".toml")
+	confPath := filepath.Join(dir, fileName+".conf")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", false, err
+	}
+	data, err := marshalService(server)
+	if err != nil {
+		return "", "", false, err
+	}
+	written, err := writeConfigFile(confPath, fileContents, policy)
+	if err != nil || !written {
+		return tomlPath, confPath, false, err
+	}
+	return tomlPath, confPath, true, writeContentToFile(tomlPath, data)
+}
+
+// saveWebSocketSnippet writes the websocketSnippet to dir for a service saved there which proxies WebSockets
+func saveWebSocketSnippet(dir string, policy overwritePolicy) error {
+	snippet := websocketSnippet()
+	path := filepath.Join(dir, snippet.FileName+".conf")
+	written, err := writeConfigFile(path, snippet.Contents, policy)
+	if err == nil && written {
+		fmt.Printf("Wrote %s defining $connection_upgrade, it has to be included once in the http block like the configs in sites-enabled are\n", path)
+	}
+	return err
+}
+
+// checkConfigs shows the diff of every config against the one in dir, returns 1 when any is missing or out of date
+func checkConfigs(configs []renderedConfig, dir string) int {
+	exitCode := exitOK
+	for _, config := range configs {
+		confPath := filepath.Join(dir, config.FileName+".conf")
+		upToDate, err := checkConfigFile(confPath, config.Contents)
+		if err != nil {
+			red.Println("Error occoured while reading config", confPath, "Details:\n", err.Error())
+			exitCode = exitError
+		} else if !upToDate {
+			exitCode = exitError
+		} else {
+			fmt.Printf("%s is up to date\n", confPath)
+		}
+	}
+	return exitCode
+}
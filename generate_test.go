@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedFiles    []string
+	}{
+		{
+			name:             "test proxy preset is written with --yes",
+			args:             []string{"--preset", "proxy", "--domains", "a.com", "--url", "http://127.0.0.1:8000", "--hsts", "--yes", "--out", dir},
+			expectedExitCode: 0,
+			expectedFiles:    []string{"a.com.conf", "a.com.toml"},
+		},
+		{
+			name:             "test check passes for the written config",
+			args:             []string{"--preset", "proxy", "--domains", "a.com", "--url", "http://127.0.0.1:8000", "--hsts", "--check", "--out", dir},
+			expectedExitCode: 0,
+		},
+		{
+			name:             "test check fails for an out of date config",
+			args:             []string{"--preset", "proxy", "--domains", "a.com", "--url", "http://127.0.0.1:8000", "--check", "--out", dir},
+			expectedExitCode: 1,
+		},
+		{
+			name:             "test changed config is not overwritten without --force",
+			args:             []string{"--preset", "proxy", "--domains", "a.com", "--url", "http://127.0.0.1:9000", "--yes", "--out", dir},
+			expectedExitCode: 1,
+		},
+		{
+			name:             "test changed config is overwritten with --force",
+			args:             []string{"--preset", "proxy", "--domains", "a.com", "--url", "http://127.0.0.1:9000", "--yes", "--force", "--out", dir},
+			expectedExitCode: 0,
+		},
+		{
+			name:             "test nothing is written without --yes",
+			args:             []string{"--preset", "static", "--domains", "b.com", "--root", "/srv/www", "--out", dir},
+			expectedExitCode: 0,
+		},
+		{
+			name:             "test missing required flags",
+			args:             []string{"--preset", "proxy-port", "--domains", "c.com", "--out", dir},
+			expectedExitCode: 2,
+		},
+		{
+			name:             "test load-balance preset with backends",
+			args:             []string{"--preset", "load-balance", "--domains", "lb.com", "--balance", "hash", "--hash-key", "$request_uri", "--backend", "10.0.0.1:8000 weight=2", "--backend", "10.0.0.2:8000", "--out", dir},
+			expectedExitCode: 0,
+		},
+		{
+			name:             "test load-balance preset without backends",
+			args:             []string{"--preset", "load-balance", "--domains", "lb.com", "--out", dir},
+			expectedExitCode: 2,
+		},
+		{
+			name:             "test unknown preset",
+			args:             []string{"--preset", "ftp", "--out", dir},
+			expectedExitCode: 2,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedExitCode, runGenerate(testCase.args))
+			for _, file := range testCase.expectedFiles {
+				assert.FileExists(t, filepath.Join(dir, file))
+			}
+		})
+	}
+	written, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Len(t, written, 2)
+}
+
+func TestRunGenerateFlagErrors(t *testing.T) {
+	var output bytes.Buffer
+	previous := color.Output
+	color.Output = &output
+	defer func() { color.Output = previous }()
+
+	assert.Equal(t, exitUsage, runGenerate([]string{"--preset", "wsgi", "--domains", "app.com", "--wsgi-socket", "unix:/run/uwsgi/app.sock", "--cache", "--out", os.TempDir()}))
+	assert.Contains(t, output.String(), "--cache: can't be used with preset 11")
+
+	output.Reset()
+	assert.Equal(t, exitUsage, runGenerate([]string{"--preset", "proxy", "--domains", "app.com", "--url", "http://127.0.0.1:8000", "--proxy-read-timeout", "5 minutes", "--out", os.TempDir()}))
+	assert.Contains(t, output.String(), "--proxy-read-timeout: ")
+	assert.Equal(t, "Proxy", fieldFlag("Proxy"))
+
+	output.Reset()
+	assert.Equal(t, exitUsage, runGenerate([]string{"--preset", "static", "--domains", "app.com", "--root", "/srv/www", "--websocket", "--out", os.TempDir()}))
+	assert.Contains(t, output.String(), "Proxy: is only used with presets 5, 7, 9 and 10")
+
+	output.Reset()
+	assert.Equal(t, exitUsage, runGenerate([]string{"--preset", "grpc", "--domains", "app.com", "--url", "grpc://127.0.0.1:50051", "--disable-buffering", "--out", os.TempDir()}))
+	assert.Contains(t, output.String(), "Proxy: only the timeouts and MaxBodySize are used with preset 10")
+}
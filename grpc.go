@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Read and send timeout of the gRPC preset when they aren't set, streams are usually kept open longer than the 60s
+// nginx defaults to
+const defaultGRPCTimeout = "1h"
+
+// grpcErrors map the errors nginx answers with when the backend fails onto gRPC status codes, which is all gRPC clients
+// understand
+var grpcErrors = []struct {
+	Location string
+	Codes    []string
+	Status   string
+	Message  string
+}{
+	{"/error502grpc", []string{"502", "503"}, "14", "unavailable"},
+	{"/error504grpc", []string{"504"}, "4", `"deadline exceeded"`},
+}
+
+// isGRPCAddress reports whether address is a grpc:// or grpcs:// backend grpc_pass accepts
+func isGRPCAddress(address string) bool {
+	parsed, err := url.Parse(address)
+	return err == nil && (parsed.Scheme == "grpc" || parsed.Scheme == "grpcs") && parsed.Host != "" && (parsed.Path == "" || parsed.Path == "/")
+}
+
+// validateGRPC reports problems with the proxy settings of the gRPC preset, which only uses the timeouts and MaxBodySize
+func validateGRPC(config ProxyConfig) ValidationErrors {
+	var errs ValidationErrors
+	if config.ForwardHeaders || config.DisableBuffering || config.WebSocket || len(config.WebSocketPaths) > 0 {
+		errs = append(errs, FieldError{Field: "Proxy", Message: "only the timeouts and MaxBodySize are used with preset 10"})
+	}
+	return append(errs, config.validate()...)
+}
+
+// buildGRPCLocations creates the location / passing requests to the gRPC backend and the locations answering its
+// errors with gRPC status codes
+func buildGRPCLocations(target string, config ProxyConfig) []Node {
+	readTimeout, sendTimeout := config.ReadTimeout, config.SendTimeout
+	if readTimeout == "" {
+		readTimeout = defaultGRPCTimeout
+	}
+	if sendTimeout == "" {
+		sendTimeout = defaultGRPCTimeout
+	}
+	location := newBlock("location", "/").add(
+		newDirective("grpc_pass", target),
+		newDirective("grpc_read_timeout", readTimeout),
+		newDirective("grpc_send_timeout", sendTimeout),
+	)
+	if config.ConnectTimeout != "" {
+		location.add(newDirective("grpc_connect_timeout", config.ConnectTimeout))
+	}
+	if config.MaxBodySize != "" {
+		location.add(newDirective("client_max_body_size", config.MaxBodySize))
+	}
+	locations := []Node{location}
+	for _, grpcError := range grpcErrors {
+		codes := append([]string{}, grpcError.Codes...)
+		location.add(newDirective("error_page", append(codes, "=", grpcError.Location)...))
+		locations = append(locations, newBlock("location", "=", grpcError.Location).add(
+			newDirective("internal"),
+			newDirective("default_type", "application/grpc"),
+			newDirective("add_header", "grpc-status", grpcError.Status),
+			newDirective("add_header", "grpc-message", grpcError.Message),
+			newDirective("return", "204"),
+		))
+	}
+	return locations
+}
+
+// isGRPCErrorLocation reports whether a location is one of the grpcErrors locations, which the preset generates itself
+func isGRPCErrorLocation(location *Directive) bool {
+	for _, grpcError := range grpcErrors {
+		if strings.Join(location.Args, " ") == "= "+grpcError.Location {
+			return true
+		}
+	}
+	return false
+}
+
+// importGRPC reads the proxy settings of a location / with grpc_pass, warning about what it can't represent
+func importGRPC(location *Directive, warn func(format string, args ...interface{})) ProxyConfig {
+	var config ProxyConfig
+	for _, node := range location.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		args := unquoteArgs(directive.Args)
+		switch name := directive.Name; {
+		case name == "grpc_pass" || name == "error_page":
+		case name == "grpc_read_timeout" && len(args) == 1:
+			if args[0] != defaultGRPCTimeout {
+				config.ReadTimeout = args[0]
+			}
+		case name == "grpc_send_timeout" && len(args) == 1:
+			if args[0] != defaultGRPCTimeout {
+				config.SendTimeout = args[0]
+			}
+		case name == "grpc_connect_timeout" && len(args) == 1:
+			config.ConnectTimeout = args[0]
+		case name == "client_max_body_size" && len(args) == 1:
+			config.MaxBodySize = args[0]
+		default:
+			warn("line %d: directive %s in location / is not supported and will be dropped", directive.Line, name)
+		}
+	}
+	return config
+}
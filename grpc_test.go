@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsGRPC(t *testing.T) {
+	service := Service{Selection: 10, Domains: "grpc.sidsun.com", URL: "grpc://127.0.0.1:50051", Port: 8080, Proxy: ProxyConfig{ConnectTimeout: "5s", MaxBodySize: "16m"}}
+	fileName, fileContents := prepareServiceFileContents(service)
+	assert.Equal(t, "grpc.sidsun.com", fileName)
+	assert.Equal(t, `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name grpc.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    location / {
+        grpc_pass grpc://127.0.0.1:50051;
+        grpc_read_timeout 1h;
+        grpc_send_timeout 1h;
+        grpc_connect_timeout 5s;
+        client_max_body_size 16m;
+        error_page 502 503 = /error502grpc;
+        error_page 504 = /error504grpc;
+    }
+    location = /error502grpc {
+        internal;
+        default_type application/grpc;
+        add_header grpc-status 14;
+        add_header grpc-message unavailable;
+        return 204;
+    }
+    location = /error504grpc {
+        internal;
+        default_type application/grpc;
+        add_header grpc-status 4;
+        add_header grpc-message "deadline exceeded";
+        return 204;
+    }
+}
+`, fileContents)
+}
+
+func TestGRPCValidate(t *testing.T) {
+	service := Service{Selection: 10, Domains: "grpc.sidsun.com", URL: "http://127.0.0.1:50051", Port: 443, Proxy: ProxyConfig{ForwardHeaders: true, ReadTimeout: "forever"}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "URL", Message: `"http://127.0.0.1:50051" is not a grpc:// or grpcs:// address`},
+		{Field: "Proxy", Message: "only the timeouts and MaxBodySize are used with preset 10"},
+		{Field: "Proxy.ReadTimeout", Message: `"forever" is not a valid nginx time (ex: 30s, 5m)`},
+	}, service.Validate())
+
+	service = Service{Selection: 10, Domains: "grpc.sidsun.com", URL: "grpcs://grpc.internal:443", Port: 443}
+	assert.NoError(t, service.Validate())
+}
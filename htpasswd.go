@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// Hash algorithms of the htpasswd command, nginx checks apr1 itself while bcrypt relies on the crypt of the system
+var htpasswdAlgorithms = []string{"bcrypt", "apr1"}
+
+// passwordInput reads the passwords when stdin isn't a terminal, it is shared so lines buffered for the next
+// password aren't lost
+var passwordInput = bufio.NewScanner(os.Stdin)
+
+// Alphabet of the salts and hashes of apr1
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func runHtpasswd(args []string) int {
+	flags := newFlagSet("htpasswd")
+	algorithm := flags.String("algorithm", "bcrypt", "hash algorithm of the passwords: "+strings.Join(htpasswdAlgorithms, ", "))
+	user := flags.String("user", "", "only set the password of this user of Auth.Users")
+	file := flags.String("file", "", "htpasswd file to write instead of Auth.UserFile, for services with a single user file")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 1 || !inStrings(*algorithm, htpasswdAlgorithms) {
+		flags.Usage()
+		return exitUsage
+	}
+
+	path := flags.Arg(0)
+	services, err := loadServiceFile(path)
+	if err == nil {
+		err = services.check(false) // The user files are named after the first domain
+	}
+	if err != nil {
+		red.Println("Error occoured while reading", path, "Details: \n", err.Error())
+		return exitError
+	}
+	written := 0
+	for _, server := range services.Services {
+		if !server.Auth.configured() {
+			continue
+		}
+		users := server.Auth.Users
+		if *user != "" {
+			if !inStrings(*user, users) {
+				continue
+			}
+			users = []string{*user}
+		}
+		userFile := server.Auth.userFile(strings.Fields(server.Domains)[0])
+		if *file != "" {
+			userFile = *file
+		}
+		fmt.Printf("Setting the passwords of %s for %s\n", strings.Join(users, ", "), server.Domains)
+		passwords := map[string]string{}
+		for _, name := range users {
+			if passwords[name], err = getPassword(name); err != nil {
+				red.Println("Error occoured while reading the password. Details: \n", err.Error())
+				return exitError
+			}
+		}
+		if err := updateHtpasswd(userFile, users, passwords, *algorithm); err != nil {
+			red.Println("Error occoured while writing", userFile, "Details: \n", err.Error())
+			return exitError
+		}
+		fmt.Println("Wrote the passwords to", userFile)
+		written++
+	}
+	if written == 0 {
+		_, _ = yellow.Println("No service of", path, "has Auth.Users to set passwords for")
+		return exitError
+	}
+	return exitOK
+}
+
+// getPassword asks for the password of user twice, without echoing it when stdin is a terminal
+func getPassword(user string) (string, error) {
+	terminal := term.IsTerminal(int(os.Stdin.Fd()))
+	for {
+		password, err := readPassword(fmt.Sprintf("Password for %s: ", user))
+		switch {
+		case err != nil:
+			return "", err
+		case password == "" && !terminal:
+			return "", fmt.Errorf("the password of %s is empty", user)
+		case password == "":
+			fmt.Println("This cannot be empty")
+			continue
+		case !terminal:
+			return password, nil
+		}
+		confirmation, err := readPassword(fmt.Sprintf("Repeat the password for %s: ", user))
+		if err != nil || confirmation == password {
+			return password, err
+		}
+		_, _ = red.Println("The passwords don't match, let's try again")
+	}
+}
+
+// readPassword prints prompt and reads a line from stdin, which isn't echoed when it is a terminal
+func readPassword(prompt string) (string, error) {
+	_, _ = cyan.Print(prompt)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		if !passwordInput.Scan() {
+			return "", fmt.Errorf("no password given")
+		}
+		fmt.Println()
+		return passwordInput.Text(), nil
+	}
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return string(password), err
+}
+
+// updateHtpasswd sets the passwords of users in the htpasswd file at path, hashed with algorithm, other users of the
+// file are kept as they are and the file is created when it doesn't exist
+func updateHtpasswd(path string, users []string, passwords map[string]string, algorithm string) error {
+	var lines []string
+	if data, err := ioutil.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, user := range users {
+		hash, err := hashPassword(passwords[user], algorithm)
+		if err != nil {
+			return err
+		}
+		entry, replaced := user+":"+hash, false
+		for i, line := range lines {
+			if strings.HasPrefix(line, user+":") {
+				lines[i], replaced = entry, true
+			}
+		}
+		if !replaced {
+			lines = append(lines, entry)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// nginx workers read the file as an unprivileged user
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// htpasswdUsers returns the users of the htpasswd file at path in the order they are listed
+func htpasswdUsers(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, ":"); i > 0 && !strings.HasPrefix(line, "#") {
+			users = append(users, line[:i])
+		}
+	}
+	return users, nil
+}
+
+// hashPassword hashes password for an htpasswd file with a bcrypt or apr1 algorithm and a random salt
+func hashPassword(password string, algorithm string) (string, error) {
+	if algorithm == "bcrypt" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	salt := make([]byte, len(random))
+	for i, b := range random {
+		salt[i] = apr1Alphabet[int(b)%len(apr1Alphabet)]
+	}
+	return apr1(password, string(salt)), nil
+}
+
+// apr1 is the MD5 based crypt of Apache, the $apr1$ variant of md5crypt
+func apr1(password string, salt string) string {
+	const magic = "$apr1$"
+	alternate := md5.Sum([]byte(password + salt + password))
+	digest := md5.New()
+	digest.Write([]byte(password + magic + salt))
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			digest.Write(alternate[:])
+		} else {
+			digest.Write(alternate[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write([]byte{password[0]})
+		}
+	}
+	final := digest.Sum(nil)
+	// The rounds only exist to slow the hash down
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write([]byte(password))
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write([]byte(password))
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write([]byte(password))
+		}
+		final = round.Sum(nil)
+	}
+	var encoded []byte
+	encode := func(value uint32, length int) {
+		for ; length > 0; length-- {
+			encoded = append(encoded, apr1Alphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return magic + salt + "$" + string(encoded)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPR1(t *testing.T) {
+	// Hashes of openssl passwd -apr1
+	assert.Equal(t, "$apr1$saltsalt$FzqJUoU5ODlS7TVX9KiBy/", apr1("secret password", "saltsalt"))
+	assert.Equal(t, "$apr1$ab$eIePjsejfBGR8ITtu2z0U1", apr1("x", "ab"))
+	assert.Equal(t, "$apr1$12345678$73hG3Nj0llBBNcNjFBzc4/", apr1("a password longer than sixteen bytes", "12345678"))
+}
+
+func TestUpdateHtpasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "htpasswd", "staging.sidsun.com")
+
+	assert.NoError(t, updateHtpasswd(path, []string{"sid", "su"}, map[string]string{"sid": "first", "su": "second"}, "apr1"))
+	assert.NoError(t, updateHtpasswd(path, []string{"sid"}, map[string]string{"sid": "changed"}, "bcrypt"))
+	users, err := htpasswdUsers(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sid", "su"}, users)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(strings.TrimPrefix(lines[0], "sid:")), []byte("changed")))
+	salt := strings.Split(lines[1], "$")[2]
+	assert.Equal(t, "su:"+apr1("second", salt), lines[1])
+}
+
+func TestRunHtpasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	userFile := filepath.Join(dir, "htpasswd")
+	service := filepath.Join(dir, "staging.toml")
+	assert.NoError(t, ioutil.WriteFile(service, []byte("Selection = 1\nDomains = \"staging.sidsun.com\"\nRoot = \"/srv/www\"\nPort = 443\n[Auth]\nUsers = [\"sid\", \"su\"]\nUserFile = \""+userFile+"\"\n"), 0644))
+	defer func() { passwordInput = bufio.NewScanner(os.Stdin) }()
+
+	passwordInput = bufio.NewScanner(strings.NewReader("first\nsecond\n"))
+	assert.Equal(t, exitOK, runHtpasswd([]string{"--algorithm", "apr1", service}))
+	users, err := htpasswdUsers(userFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sid", "su"}, users)
+
+	passwordInput = bufio.NewScanner(strings.NewReader(""))
+	assert.Equal(t, exitError, runHtpasswd([]string{"--user", "sid", service}))
+	assert.Equal(t, exitError, runHtpasswd([]string{"--user", "nobody", service}))
+	assert.Equal(t, exitUsage, runHtpasswd([]string{"--algorithm", "md5", service}))
+
+	assert.NoError(t, ioutil.WriteFile(service, []byte("Selection = 1\nDomains = \" \"\nRoot = \"/srv/www\"\nPort = 443\n[Auth]\nUsers = [\"sid\"]\n"), 0644))
+	assert.Equal(t, exitError, runHtpasswd([]string{service}))
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// importResult is the outcome of mapping one parsed server block onto a Service
+// Warnings list what the Service cannot represent, Problems are set when no preset matches the block
+type importResult struct {
+	Line     int
+	Service  Service
+	Warnings []string
+	Problems []string
+}
+
+// Directives emitted by the security config which are consumed when mapping it back
+var securityDirectives = []string{
+	"server_tokens", "client_body_buffer_size", "client_header_buffer_size", "client_max_body_size",
+	"large_client_header_buffers", "client_body_timeout", "client_header_timeout", "keepalive_timeout", "send_timeout",
+}
+
+var securityHeaders = []string{"X-Frame-Options", "X-Content-Type-Options", "X-XSS-Protection"}
+
+// importFiles parses every nginx config in paths and writes a TOML file for each server block that maps onto a preset
+// It returns the exit code: 0 when every block was imported, 1 otherwise
+func importFiles(paths []string, out string) int {
+	exitCode := exitOK
+	if err := os.MkdirAll(out, 0755); err != nil {
+		red.Println("Error occoured while creating", out, "Details:\n", err.Error())
+		return exitError
+	}
+	for _, path := range paths {
+		if !fileExists(path) {
+			red.Println("File:", path, "seems to be nonexistent")
+			exitCode = exitError
+			continue
+		}
+		nodes, err := parseConfig(readFromFile(path))
+		if err != nil {
+			red.Println("Error occoured while parsing", path, "Details:\n", err.Error())
+			exitCode = exitError
+			continue
+		}
+		results := importServerBlocks(nodes)
+		if len(results) == 0 {
+			_, _ = yellow.Println("No server blocks found in", path)
+		}
+		for _, result := range results {
+			location := fmt.Sprintf("%s:%d", path, result.Line)
+			if len(result.Problems) == 0 {
+				// Blocks mapping onto a preset can still hold values the service files don't accept
+				if err := result.Service.Validate(); err != nil {
+					for _, fieldError := range err.(ValidationErrors) {
+						result.Problems = append(result.Problems, fieldError.Error())
+					}
+				}
+			}
+			if len(result.Problems) > 0 {
+				_, _ = red.Printf("Skipped server block at %s:\n", location)
+				for _, problem := range result.Problems {
+					_, _ = red.Println("  -", problem)
+				}
+				exitCode = exitError
+				continue
+			}
+			for _, warning := range result.Warnings {
+				_, _ = yellow.Printf("Warning: %s: %s\n", location, warning)
+			}
+			fileName, _ := buildServerBlock(result.Service)
+			tomlPath := filepath.Join(out, fileName+".toml")
+			if fileExists(tomlPath) {
+				_, _ = red.Printf("Skipped server block at %s: %s already exists\n", location, tomlPath)
+				exitCode = exitError
+				continue
+			}
+			data, err := marshalService(result.Service)
+			if err == nil {
+				err = writeContentToFile(tomlPath, data)
+			}
+			if err != nil {
+				red.Println("Error occoured while writing config", tomlPath, "Details:\n", err.Error())
+				exitCode = exitError
+				continue
+			}
+			fmt.Printf("Imported server block at %s as preset %d to %s\n", location, result.Service.Selection, tomlPath)
+		}
+	}
+	return exitCode
+}
+
+// importServerBlocks maps every server block, either at the top level or inside http {}, onto a Service
+// Proxies to an upstream block at the same level become the load-balance preset
+func importServerBlocks(nodes []Node) []importResult {
+	var results []importResult
+	upstreams := map[string]*Directive{}
+	for _, node := range nodes {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		switch directive.Name {
+		case "server":
+			if redirect, ok := parseRedirectBlock(directive); ok && foldRedirectBlock(redirect, results) {
+				continue
+			}
+			results = append(results, importServerBlock(directive))
+		case "http":
+			results = append(results, importServerBlocks(directive.Block)...)
+		case "upstream":
+			if len(directive.Args) == 1 {
+				upstreams[directive.Args[0]] = directive
+			}
+		}
+	}
+	for i := range results {
+		importUpstreamProxy(&results[i], upstreams)
+	}
+	return results
+}
+
+// importUpstreamProxy turns a proxy whose proxy_pass points at one of the upstream blocks into the load-balance preset
+func importUpstreamProxy(result *importResult, upstreams map[string]*Directive) {
+	server := &result.Service
+	if !inRange(server.Selection, []int{5, 7}) || !strings.HasPrefix(server.URL, "http://") {
+		return
+	}
+	block, ok := upstreams[strings.TrimPrefix(server.URL, "http://")]
+	if !ok {
+		return
+	}
+	warn := func(format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(format, args...))
+	}
+	upstream, err := importUpstream(block, warn)
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return
+	}
+	server.Selection, server.URL, server.Upstream = 9, "", upstream
+	if fileName, _ := buildServerBlock(*server); upstreamName(fileName) != block.Args[0] {
+		warn("line %d: upstream %s will be generated as upstream %s", block.Line, block.Args[0], upstreamName(fileName))
+	}
+}
+
+// redirectBlock is a server block which only redirects, like the ones generated for RedirectHTTP and CanonicalHost
+type redirectBlock struct {
+	Port    int
+	Names   []string
+	Target  string
+	Webroot string // Set when the ACME challenge path is served before redirecting
+}
+
+// parseRedirectBlock reads a server block consisting only of listen, server_name, SSL directives and a redirect,
+// optionally in location / after an ACME challenge location
+func parseRedirectBlock(block *Directive) (redirectBlock, bool) {
+	redirect := redirectBlock{Port: 80}
+	var listen *Directive
+	for _, node := range block.Block {
+		directive, ok := node.(*Directive)
+		if !ok {
+			continue
+		}
+		if directive.Name == "listen" && listen == nil {
+			listen = directive // The placeholder listen directives of generated HTTPS configs are commented out
+		}
+		if directive.Commented {
+			continue
+		}
+		switch args := directive.Args; {
+		case directive.Name == "listen" || strings.HasPrefix(directive.Name, "ssl_") || directive.Name == "resolver":
+		case directive.Name == "server_name":
+			redirect.Names = unquoteArgs(args)
+		case directive.Name == "return" && len(args) == 2 && inStrings(args[0], []string{"301", "302", "307", "308"}):
+			redirect.Target = unquote(args[1])
+		case directive.Name == "location" && len(args) == 2 && args[0] == "^~" && args[1] == "/.well-known/acme-challenge/" && len(directive.findAll("root")) == 1 && len(directive.find("root").Args) == 1:
+			redirect.Webroot = unquote(directive.find("root").Args[0])
+		case directive.Name == "location" && len(args) == 1 && args[0] == "/" && len(directive.Block) == 1 && directive.find("return") != nil && len(directive.find("return").Args) == 2:
+			redirect.Target = unquote(directive.find("return").Args[1])
+		default:
+			return redirect, false
+		}
+	}
+	if listen != nil {
+		port, isDefault, err := parseListen(listen)
+		if err != nil || isDefault {
+			return redirect, false
+		}
+		redirect.Port = port
+	}
+	return redirect, redirect.Target != "" && len(redirect.Names) > 0
+}
+
+// foldRedirectBlock maps a redirect block generated for a service in results back onto it, returns whether it was one
+func foldRedirectBlock(redirect redirectBlock, results []importResult) bool {
+	names := strings.Join(redirect.Names, " ")
+	for i := range results {
+		server := &results[i].Service
+		switch {
+		case server.Port == 443 && redirect.Port == 80 && redirect.Target == "https://$host$request_uri" && !server.Additional.RedirectHTTP && names == server.servedNames():
+			server.Additional.RedirectHTTP = true
+			server.Additional.ChallengeWebroot = redirect.Webroot
+			return true
+		case server.CanonicalHost == "" && redirect.Port == server.Port && redirect.Webroot == "" && !strings.Contains(server.Domains, " "):
+			canonical := *server
+			canonical.CanonicalHost = server.Domains
+			if redirect.Target == canonical.canonicalURL() {
+				server.CanonicalHost = server.Domains
+				server.Domains += " " + names
+				return true
+			}
+		case server.CanonicalHost != "" && server.Port == 443 && redirect.Port == 80 && redirect.Target == server.canonicalURL() && names == strings.Join(server.aliases(), " "):
+			return true // The port 80 redirect of the aliases, its webroot is the one of the RedirectHTTP block
+		}
+	}
+	return false
+}
+
+func importServerBlock(block *Directive) importResult {
+	result := importResult{Line: block.Line}
+	server := &result.Service
+	warn := func(format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(format, args...))
+	}
+	fail := func(format string, args ...interface{}) {
+		result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+	}
+
+	if serverName := block.find("server_name"); serverName == nil || len(serverName.Args) == 0 {
+		fail("no server_name directive")
+	} else if server.Domains = strings.Join(strings.Fields(strings.Join(unquoteArgs(serverName.Args), " ")), " "); server.Domains == "" {
+		// server_name "" matches requests without a Host header, the service needs a name for its files
+		fail("line %d: no server_name to name the service after", serverName.Line)
+	}
+	var fileName string // The htpasswd file of the service is named after it like its other files
+	if names := strings.Fields(server.Domains); len(names) > 0 {
+		fileName = names[0]
+	}
+	server.Auth, _ = importAuth(block, fileName)
+
+	listen := block.find("listen")
+	if listen == nil {
+		// The placeholder listen directives of generated HTTPS configs are commented out
+		for _, node := range block.Block {
+			if directive, ok := node.(*Directive); ok && directive.Commented && directive.Name == "listen" {
+				listen = directive
+				break
+			}
+		}
+	}
+	if listen == nil {
+		warn("no listen directive, using port 80")
+		server.Port = 80
+	} else if port, isDefault, err := parseListen(listen); err != nil {
+		fail("line %d: %s", listen.Line, err.Error())
+	} else {
+		server.Port = port
+		server.Additional.MakeDefaultServer = isDefault
+	}
+
+	if certificate := block.find("ssl_certificate"); certificate != nil && len(certificate.Args) == 1 {
+		server.Additional.TLS = importTLS(block, unquote(certificate.Args[0]), strings.Fields(server.Domains))
+		server.Additional.TLS.Profile, server.Additional.TLS.Resolver = importTLSProfile(block)
+	}
+
+	if serverTokens := block.find("server_tokens"); serverTokens != nil && len(serverTokens.Args) == 1 {
+		server.Additional.AddSecurityConfig = unquote(serverTokens.Args[0]) == "off"
+	}
+
+	var root, rootLocation, rewritesLocation, phpLocation *Directive
+	var otherLocations []*Directive // Locations of the service or WebSocketPaths of a proxy, in order
+	var wordpressLocations []*Directive
+	for _, node := range block.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		switch name := directive.Name; {
+		case name == "listen" || name == "server_name" || name == "access_log" || name == "error_log" || name == "index":
+		case strings.HasPrefix(name, "ssl_"):
+		case name == "resolver" && server.Additional.TLS.Profile != "":
+		case name == "root":
+			root = directive
+		case name == "return":
+		case name == "add_header":
+			if len(directive.Args) > 0 && directive.Args[0] == "Strict-Transport-Security" {
+				server.Additional.AddHSTSConfig = true
+			} else if !server.Additional.AddSecurityConfig || len(directive.Args) == 0 || !inStrings(directive.Args[0], securityHeaders) {
+				warn("line %d: add_header %s is not supported and will be dropped", directive.Line, strings.Join(directive.Args, " "))
+			}
+		case inStrings(name, securityDirectives) && server.Additional.AddSecurityConfig:
+		case name == "location":
+			switch args := directive.Args; {
+			case len(args) == 1 && args[0] == "/":
+				rootLocation = directive
+			case len(args) == 1 && args[0] == "@rewrites":
+				rewritesLocation = directive
+			case isGRPCErrorLocation(directive):
+			case isWordPressLocation(directive):
+				wordpressLocations = append(wordpressLocations, directive)
+			case len(args) == 2 && strings.HasPrefix(args[0], "~") && strings.Contains(args[1], "php") && directive.find("fastcgi_pass") != nil:
+				phpLocation = directive
+			case len(args) == 2 && args[0] == "~*" && directive.find("expires") != nil && len(directive.find("expires").Args) == 1:
+				server.Additional.AddCachingConfig = true
+				server.Additional.MaxCacheAge = unquote(directive.find("expires").Args[0])
+			default:
+				otherLocations = append(otherLocations, directive)
+			}
+		default:
+			warn("line %d: directive %s is not supported and will be dropped", directive.Line, name)
+		}
+	}
+
+	switch ret := block.find("return"); {
+	case ret != nil:
+		if len(ret.Args) != 2 {
+			fail("line %d: return without a redirect address is not supported", ret.Line)
+			break
+		}
+		if !inStrings(ret.Args[0], []string{"301", "302", "303", "307", "308"}) {
+			fail("line %d: return %s is not a redirect", ret.Line, ret.Args[0])
+			break
+		}
+		if ret.Args[0] != "308" {
+			warn("line %d: return %s will be generated as a permanent (308) redirect", ret.Line, ret.Args[0])
+		}
+		if url := unquote(ret.Args[1]); url == "https://$host$request_uri" {
+			server.Selection = 8
+		} else {
+			server.Selection = 6
+			server.URL = url
+		}
+	case phpLocation != nil && rootLocation != nil && isWordPressTryFiles(rootLocation.find("try_files")):
+		server.Selection = 12
+		server.PHPBackend = importPHPBackend(phpLocation.find("fastcgi_pass"))
+		wordpressLocations = nil // The preset generates them itself
+	case phpLocation != nil:
+		server.Selection = 4
+		server.PHPBackend = importPHPBackend(phpLocation.find("fastcgi_pass"))
+	case rootLocation != nil && rootLocation.find("proxy_pass") != nil && len(rootLocation.find("proxy_pass").Args) == 1:
+		server.Selection = 5
+		if server.Port != 443 {
+			server.Selection = 7
+		}
+		server.URL = unquote(rootLocation.find("proxy_pass").Args[0])
+		server.Proxy = importProxy(rootLocation, warn)
+		otherLocations = importWebSocketPaths(server, rootLocation, otherLocations)
+		otherLocations = importGunicorn(server, otherLocations)
+	case rootLocation != nil && rootLocation.find("grpc_pass") != nil && len(rootLocation.find("grpc_pass").Args) == 1:
+		server.Selection = 10
+		server.URL = unquote(rootLocation.find("grpc_pass").Args[0])
+		server.Proxy = importGRPC(rootLocation, warn)
+	case rootLocation != nil && rootLocation.find("uwsgi_pass") != nil && len(rootLocation.find("uwsgi_pass").Args) == 1:
+		server.Selection = 11
+		server.WSGI = importUWSGI(rootLocation, warn)
+		otherLocations = importWSGIDirectories(&server.WSGI, otherLocations)
+	case rootLocation != nil && isRoutedTryFiles(rootLocation.find("try_files")):
+		server.Selection = 3
+		rewritesLocation = nil // The preset generates its own @rewrites location
+	case root == nil && rootLocation != nil && rootLocation.find("root") != nil:
+		server.Selection = 2
+	case root != nil:
+		server.Selection = 1
+	default:
+		fail("no supported content handler (root, try_files, fastcgi_pass, proxy_pass, grpc_pass, uwsgi_pass or return) found")
+	}
+	otherLocations = append(otherLocations, wordpressLocations...)
+	if rewritesLocation != nil {
+		warn("line %d: location @rewrites is not supported and will be dropped", rewritesLocation.Line)
+	}
+	for _, block := range otherLocations {
+		auth, hasAuth := importAuth(block, fileName)
+		if location, ok := importLocation(block, warn); ok {
+			if len(block.Args) == 1 {
+				warn("line %d: location %s will be generated as location ^~ %s, regex locations no longer take its requests", block.Line, block.Args[0], block.Args[0])
+			}
+			sameAuth := hasAuth && auth.Realm == server.Auth.Realm && auth.UserFile == server.Auth.UserFile
+			switch {
+			case hasAuth && location.Match == "regex":
+				warn("line %d: auth_basic of a regex location will be dropped, the regexes before it could answer its requests without credentials", block.Line)
+			case hasAuth && !server.Auth.configured():
+				server.Auth = auth
+				server.Auth.Path = location.Path
+			case sameAuth && (server.Auth.Path == "" || location.Path == server.Auth.Path):
+			case sameAuth && isAuthPrefix(*server, server.Auth.Path) && strings.HasPrefix(location.Path, server.Auth.Path):
+				// Prefixes under the protected one are generated with its auth_basic
+			case sameAuth && location.Match == "prefix" && strings.HasPrefix(server.Auth.Path, location.Path):
+				server.Auth.Path = location.Path
+			case hasAuth:
+				warn("line %d: only one location or the whole service can ask for credentials, auth_basic will be dropped", block.Line)
+			}
+			server.Locations = append(server.Locations, location)
+		} else {
+			warn("line %d: location %s is not supported and will be dropped", block.Line, strings.Join(block.Args, " "))
+		}
+	}
+
+	if server.Auth.configured() {
+		if users, err := htpasswdUsers(server.Auth.userFile(fileName)); err != nil {
+			warn("users of %s can't be read (%s), list them in Auth.Users", server.Auth.userFile(fileName), err.Error())
+		} else {
+			server.Auth.Users = users
+		}
+	}
+
+	if inRange(server.Selection, []int{1, 2, 3, 4, 12}) {
+		if root == nil && rootLocation != nil {
+			root = rootLocation.find("root")
+		}
+		if root == nil || len(root.Args) == 0 {
+			fail("preset %d needs a root directive", server.Selection)
+		} else {
+			server.Root = unquote(root.Args[0])
+		}
+	}
+	return result
+}
+
+// importWebSocketPaths adds the prefix locations passing WebSockets to the same backend as location / to the
+// WebSocketPaths of server, returns the other locations
+func importWebSocketPaths(server *Service, rootLocation *Directive, locations []*Directive) []*Directive {
+	var others []*Directive
+	target := strings.Join(rootLocation.find("proxy_pass").Args, " ")
+	for _, location := range locations {
+		proxy := location.find("proxy_pass")
+		if len(location.Args) != 1 || proxy == nil || strings.Join(proxy.Args, " ") != target || !importProxy(location, func(string, ...interface{}) {}).WebSocket {
+			others = append(others, location)
+			continue
+		}
+		server.Proxy.WebSocketPaths = append(server.Proxy.WebSocketPaths, location.Args[0])
+	}
+	return others
+}
+
+// importTLS reads the certificate files of a server block, paths certbot would use for the first domain become LetsEncrypt
+func importTLS(block *Directive, certificate string, domains []string) TLSConfig {
+	config := TLSConfig{Certificate: certificate}
+	if key := block.find("ssl_certificate_key"); key != nil && len(key.Args) == 1 {
+		config.Key = unquote(key.Args[0])
+	}
+	if chain := block.find("ssl_trusted_certificate"); chain != nil && len(chain.Args) == 1 {
+		config.Chain = unquote(chain.Args[0])
+	}
+	if len(domains) == 0 || filepath.Base(filepath.Dir(certificate)) != domains[0] {
+		return config
+	}
+	letsEncrypt := TLSConfig{LetsEncrypt: true, LiveDir: filepath.Dir(filepath.Dir(certificate))}
+	if letsEncrypt.LiveDir == defaultLetsEncryptDir {
+		letsEncrypt.LiveDir = ""
+	}
+	if certificate, key, chain := letsEncrypt.paths(domains[0]); config == (TLSConfig{Certificate: certificate, Key: key, Chain: chain}) {
+		return letsEncrypt
+	}
+	return config
+}
+
+// importTLSProfile returns the Mozilla profile whose protocols and ciphers the server block uses and its resolver,
+// both are empty when no profile matches
+func importTLSProfile(block *Directive) (string, string) {
+	protocols, ciphers := block.find("ssl_protocols"), block.find("ssl_ciphers")
+	if protocols == nil || block.find("ssl_stapling") == nil {
+		return "", ""
+	}
+	for _, profile := range tlsProfiles {
+		if strings.Join(profile.Protocols, " ") != strings.Join(protocols.Args, " ") {
+			continue
+		}
+		if (ciphers == nil) != (profile.Ciphers == "") || (ciphers != nil && strings.Join(unquoteArgs(ciphers.Args), " ") != profile.Ciphers) {
+			continue
+		}
+		resolver := ""
+		if directive := block.find("resolver"); directive != nil && strings.Join(directive.Args, " ") != defaultResolver {
+			resolver = strings.Join(directive.Args, " ")
+		}
+		return profile.Name, resolver
+	}
+	return "", ""
+}
+
+// parseListen reads the port and default_server flag from a listen directive (ex: listen [::]:443 ssl default_server;)
+func parseListen(listen *Directive) (int, bool, error) {
+	if len(listen.Args) == 0 {
+		return 0, false, fmt.Errorf("listen has no address")
+	}
+	address := unquote(listen.Args[0])
+	if strings.HasPrefix(address, "unix:") {
+		return 0, false, fmt.Errorf("listening on unix socket %s is not supported", address)
+	}
+	port := "80"
+	if index := strings.LastIndex(address, ":"); index != -1 && index > strings.LastIndex(address, "]") {
+		port = address[index+1:]
+	} else if !strings.ContainsAny(address, ".[]*") {
+		port = address
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid port in listen %s", address)
+	}
+	return number, inStrings("default_server", listen.Args[1:]), nil
+}
+
+// isRoutedTryFiles reports whether try_files hands unknown paths to the webapp (ex: try_files $uri $uri/ /index.html;)
+func isRoutedTryFiles(tryFiles *Directive) bool {
+	if tryFiles == nil || len(tryFiles.Args) == 0 {
+		return false
+	}
+	fallback := tryFiles.Args[len(tryFiles.Args)-1]
+	return fallback == "@rewrites" || strings.HasSuffix(fallback, "/index.html")
+}
+
+func unquote(arg string) string {
+	if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+func unquoteArgs(args []string) []string {
+	unquoted := make([]string, len(args))
+	for i, arg := range args {
+		unquoted[i] = unquote(arg)
+	}
+	return unquoted
+}
+
+func inStrings(value string, span []string) bool {
+	for _, s := range span {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
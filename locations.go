@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Location routes the requests matching Path to a handler of its own instead of the preset of the Service
+type Location struct {
+	Match      string      // prefix (default), exact or regex
+	Path       string      // Path or regex the requests are matched against (ex: /api/)
+	Selection  int         // Preset whose handler serves the location: 1-6
+	Root       string      // For presets 1-4, the Path is appended to it like with the root of the Service
+	URL        string      // For presets 5 and 6
+	Proxy      ProxyConfig // For preset 5
+	PHPBackend string      // For preset 4, see Service
+}
+
+// Matchers of Location and the modifier of the location directive for them, prefixes use ^~ so the regex locations of
+// the preset (PHP files, cached assets) don't take over their requests
+var locationMatchers = []struct{ Name, Modifier string }{
+	{"prefix", "^~"},
+	{"exact", "="},
+	{"regex", "~"},
+}
+
+// args returns the arguments of the location directive for the location
+func (location Location) args() []string {
+	for _, matcher := range locationMatchers {
+		if matcher.Name == location.Match {
+			return []string{matcher.Modifier, location.Path}
+		}
+	}
+	return []string{"^~", location.Path} // prefix is the default
+}
+
+// parseLocation reads a location of the --location flag: <match> <path> <preset name> <root or URL>
+func parseLocation(fields []string) (Location, error) {
+	if len(fields) != 4 {
+		return Location{}, fmt.Errorf("expected <prefix|exact|regex> <path> <preset> <root or url>, got %q", strings.Join(fields, " "))
+	}
+	selected, ok := presetByName(fields[2])
+	if !ok {
+		return Location{}, fmt.Errorf("unknown preset %q", fields[2])
+	}
+	location := Location{Match: fields[0], Path: fields[1], Selection: selected.Selection}
+	if inRange(location.Selection, []int{5, 6}) {
+		location.URL = fields[3]
+	} else {
+		location.Root = fields[3]
+	}
+	return location, nil
+}
+
+// locationFlags collects the repeatable --location flag
+type locationFlags []Location
+
+func (locations *locationFlags) String() string {
+	paths := make([]string, len(*locations))
+	for i, location := range *locations {
+		paths[i] = strings.Join(location.args(), " ")
+	}
+	return strings.Join(paths, ", ")
+}
+
+func (locations *locationFlags) Set(value string) error {
+	location, err := parseLocation(strings.Fields(value))
+	if err != nil {
+		return err
+	}
+	*locations = append(*locations, location)
+	return nil
+}
+
+// validateLocations reports problems with the Locations of a service, which are identified by their path
+func validateLocations(server Service) ValidationErrors {
+	var errs ValidationErrors
+	add := func(location Location, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: "Locations", Message: fmt.Sprintf("%q: ", location.Path) + fmt.Sprintf(format, args...)})
+	}
+	if len(server.Locations) > 0 && inRange(server.Selection, []int{6, 8}) {
+		errs = append(errs, FieldError{Field: "Locations", Message: fmt.Sprintf("can't be used with preset %d, which redirects every request", server.Selection)})
+	}
+	seen := map[string]bool{}
+	for _, location := range server.Locations {
+		isMatcher := location.Match == ""
+		for _, matcher := range locationMatchers {
+			isMatcher = isMatcher || matcher.Name == location.Match
+		}
+		switch {
+		case !isMatcher:
+			add(location, "match %q must be one of prefix, exact, regex", location.Match)
+		case location.Path == "" || strings.ContainsAny(location.Path, " \t;{}"):
+			add(location, "is not a path or regex without spaces, semicolons and braces")
+		case location.Match != "regex" && !strings.HasPrefix(location.Path, "/"):
+			add(location, "has to start with /")
+		case (location.Match == "" || location.Match == "prefix") && location.Path == "/":
+			add(location, "is served by the preset of the service")
+		case server.Selection == 11 && (location.Match == "" || location.Match == "prefix") && isWSGIDirectory(server.WSGI, location.Path):
+			add(location, "is served from the directories of the wsgi preset")
+		case seen[strings.Join(location.args(), " ")]:
+			add(location, "is listed more than once")
+		}
+		seen[strings.Join(location.args(), " ")] = true
+
+		switch {
+		case !inRange(location.Selection, []int{1, 2, 3, 4, 5, 6}):
+			add(location, "preset %d can't be used for a location, must be one of 1-6", location.Selection)
+		case inRange(location.Selection, []int{1, 2, 3, 4}) && location.Root == "":
+			add(location, "root is required for preset %d", location.Selection)
+		case inRange(location.Selection, []int{5, 6}) && location.URL == "":
+			add(location, "URL is required for preset %d", location.Selection)
+		case location.Selection == 3 && location.Match == "regex":
+			add(location, "preset 3 needs a prefix or exact match to route to its index.html")
+		}
+		if inRange(location.Selection, []int{5, 6}) && location.URL != "" {
+			if parsed, err := url.Parse(location.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				add(location, "%q is not an http(s) URL", location.URL)
+			} else if location.Selection == 5 && location.Match == "regex" && parsed.Path != "" {
+				add(location, "a regex location can only proxy to a URL without a path")
+			}
+		}
+		if location.Selection == 5 {
+			if len(location.Proxy.WebSocketPaths) > 0 {
+				add(location, "use WebSocket instead of WebSocketPaths in a location")
+			}
+			for _, err := range location.Proxy.validate() {
+				add(location, "%s %s", err.Field, err.Message)
+			}
+		} else if location.Proxy.configured() {
+			add(location, "proxy settings are only used with preset 5")
+		}
+		if location.PHPBackend != "" && location.Selection != 4 {
+			add(location, "PHPBackend is only used with preset 4")
+		} else if location.PHPBackend != "" && !isFastCGIAddress(location.PHPBackend) {
+			add(location, "PHPBackend %q is not a unix:/path socket or host:port", location.PHPBackend)
+		}
+	}
+	return errs
+}
+
+// buildLocation creates the location block serving the requests of location with the handler of its preset
+func buildLocation(location Location) *Directive {
+	if location.Selection == 5 {
+		return buildProxyLocation(location.args(), location.URL, location.Proxy, false, location.Proxy.WebSocket)
+	}
+	block := newBlock("location", location.args()...)
+	switch location.Selection {
+	case 1:
+		block.add(newDirective("root", location.Root), newDirective("index", "index.html"))
+	case 2:
+		block.add(newDirective("root", location.Root))
+	case 3:
+		// Routes of the webapp are answered with the index.html of the directory the location is mounted at
+		index := location.Path
+		if !strings.HasSuffix(index, "/") {
+			index = index[:strings.LastIndex(index, "/")+1]
+		}
+		block.add(
+			newDirective("root", location.Root),
+			newDirective("index", "index.html"),
+			newDirective("try_files", "$uri", "$uri/", index+"index.html"),
+		)
+	case 4:
+		block.add(
+			newDirective("root", location.Root),
+			newDirective("index", "index.php"),
+			newDirective("try_files", "$uri", "$uri/", "=404"),
+			buildPHPLocation("~", location.PHPBackend),
+		)
+	case 6:
+		block.add(newDirective("return", "308", location.URL))
+	}
+	return block
+}
+
+// importLocation maps a location block generated by buildLocation back onto a Location
+func importLocation(block *Directive, warn func(format string, args ...interface{})) (Location, bool) {
+	var location Location
+	switch args := unquoteArgs(block.Args); {
+	case len(args) == 1:
+		location.Match, location.Path = "prefix", args[0]
+	case len(args) == 2 && args[0] == "^~":
+		location.Match, location.Path = "prefix", args[1]
+	case len(args) == 2 && args[0] == "=":
+		location.Match, location.Path = "exact", args[1]
+	case len(args) == 2 && args[0] == "~":
+		location.Match, location.Path = "regex", args[1]
+	default:
+		return location, false
+	}
+	root, tryFiles, index := block.find("root"), block.find("try_files"), block.find("index")
+	if root != nil && len(root.Args) == 1 {
+		location.Root = unquote(root.Args[0])
+	}
+	nested := block.find("location")
+	switch ret, proxy := block.find("return"), block.find("proxy_pass"); {
+	case proxy != nil && len(proxy.Args) == 1:
+		location.Selection = 5
+		location.URL = unquote(proxy.Args[0])
+		location.Proxy = importProxy(block, warn)
+		return location, true
+	case ret != nil && len(ret.Args) == 2 && len(block.Block) == 1:
+		location.Selection = 6
+		location.URL = unquote(ret.Args[1])
+		return location, true
+	case root == nil:
+		return location, false
+	case nested != nil && nested.find("fastcgi_pass") != nil:
+		location.Selection = 4
+		location.PHPBackend = importPHPBackend(nested.find("fastcgi_pass"))
+		return location, len(block.Block) == 4
+	case tryFiles != nil:
+		location.Selection = 3
+		return location, len(block.Block) == 3 && len(tryFiles.Args) == 3 && strings.HasSuffix(tryFiles.Args[2], "index.html")
+	case index != nil:
+		location.Selection = 1
+		return location, len(block.Block) == 2
+	default:
+		location.Selection = 2
+		return location, len(block.Block) == 1
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsLocations(t *testing.T) {
+	service := Service{Selection: 3, Domains: "sidsun.com", Root: "/srv/www/app", Port: 8080, Additional: Additions{AddCachingConfig: true}, Locations: []Location{
+		{Match: "prefix", Path: "/api/", Selection: 5, URL: "http://127.0.0.1:8000", Proxy: ProxyConfig{ForwardHeaders: true}},
+		{Match: "prefix", Path: "/static/", Selection: 2, Root: "/srv/www/assets"},
+		{Match: "exact", Path: "/status", Selection: 6, URL: "https://status.sidsun.com"},
+		{Match: "regex", Path: `^/blog/.*\.php$`, Selection: 4, Root: "/srv/www/blog"},
+		{Match: "prefix", Path: "/admin/", Selection: 3, Root: "/srv/www/admin"},
+	}}
+	_, fileContents := prepareServiceFileContents(service)
+	assert.Equal(t, `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    root /srv/www/app;
+    index index.html;
+    location ^~ /api/ {
+        proxy_pass http://127.0.0.1:8000;
+        proxy_read_timeout  90;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+    location ^~ /static/ {
+        root /srv/www/assets;
+    }
+    location = /status {
+        return 308 https://status.sidsun.com;
+    }
+    location ~ ^/blog/.*\.php$ {
+        root /srv/www/blog;
+        index index.php;
+        try_files $uri $uri/ =404;
+        location ~ \.php$ {
+            include snippets/fastcgi-php.conf;
+            fastcgi_pass  unix:/var/run/php/php7.2-fpm.sock;
+        }
+    }
+    location ^~ /admin/ {
+        root /srv/www/admin;
+        index index.html;
+        try_files $uri $uri/ /admin/index.html;
+    }
+    location / {
+        try_files $uri $uri/ @rewrites;
+    }
+    location @rewrites {
+        rewrite ^(.+)$ /index.html last;
+    }
+    location ~* \.(js|css|json|png|jpg|jpeg|gif|ico)$ {
+        expires 6h;
+        add_header Cache-Control "public, no-transform";
+    }
+}
+`, fileContents)
+}
+
+func TestParseLocation(t *testing.T) {
+	location, err := parseLocation([]string{"prefix", "/api/", "proxy", "http://127.0.0.1:8000"})
+	assert.NoError(t, err)
+	assert.Equal(t, Location{Match: "prefix", Path: "/api/", Selection: 5, URL: "http://127.0.0.1:8000"}, location)
+	location, err = parseLocation([]string{"exact", "/robots.txt", "files", "/srv/www/meta"})
+	assert.NoError(t, err)
+	assert.Equal(t, Location{Match: "exact", Path: "/robots.txt", Selection: 2, Root: "/srv/www/meta"}, location)
+
+	_, err = parseLocation([]string{"prefix", "/api/", "ftp", "/srv"})
+	assert.EqualError(t, err, `unknown preset "ftp"`)
+	_, err = parseLocation([]string{"/api/", "proxy"})
+	assert.Error(t, err)
+}
+
+func TestValidateLocations(t *testing.T) {
+	service := Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Locations: []Location{
+		{Match: "glob", Path: "/api/", Selection: 5, URL: "http://127.0.0.1:9000"},
+		{Match: "prefix", Path: "/", Selection: 1, Root: "/srv/www"},
+		{Match: "prefix", Path: "static/", Selection: 2, Root: "/srv/www"},
+		{Match: "regex", Path: `\.jpg$`, Selection: 5, URL: "http://127.0.0.1:9000/images/"},
+		{Match: "exact", Path: "/app", Selection: 9},
+		{Match: "prefix", Path: "/files/", Selection: 2, Root: "/srv/files", Proxy: ProxyConfig{ForwardHeaders: true}},
+	}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Locations", Message: `"/api/": match "glob" must be one of prefix, exact, regex`},
+		{Field: "Locations", Message: `"/": is served by the preset of the service`},
+		{Field: "Locations", Message: `"static/": has to start with /`},
+		{Field: "Locations", Message: `"\\.jpg$": a regex location can only proxy to a URL without a path`},
+		{Field: "Locations", Message: `"/app": preset 9 can't be used for a location, must be one of 1-6`},
+		{Field: "Locations", Message: `"/files/": proxy settings are only used with preset 5`},
+	}, service.Validate())
+
+	redirect := Service{Selection: 6, Domains: "sidsun.com", URL: "https://sulabs.org", Port: 443, Locations: []Location{{Path: "/api/", Selection: 5, URL: "http://127.0.0.1:8000"}}}
+	assert.Equal(t, ValidationErrors{{Field: "Locations", Message: "can't be used with preset 6, which redirects every request"}}, redirect.Validate())
+}
+
+func TestPrefixLocationsBeforePresetRegexes(t *testing.T) {
+	// The PHP and caching regexes of the preset must not take /api/x.php or /api/x.json from the proxy
+	service := Service{Selection: 4, Domains: "php.sidsun.com", Root: "/srv/www/php", Port: 8080, Additional: Additions{AddCachingConfig: true},
+		Locations: []Location{{Path: "/api/", Selection: 5, URL: "http://127.0.0.1:8000"}}}
+	_, fileContents := prepareServiceFileContents(service)
+	assert.Contains(t, fileContents, "    location ^~ /api/ {\n        proxy_pass http://127.0.0.1:8000;\n")
+	assert.NotContains(t, fileContents, "location /api/")
+}
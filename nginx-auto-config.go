@@ -7,18 +7,25 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
-	"github.com/pelletier/go-toml"
 )
 
-const version string = "6.1.0" // Program Version
+const version string = "6.25.1" // Program Version
 
 type Service struct {
-	Selection  int
-	Domains    string
-	Root       string
-	URL        string
-	Port       int
-	Additional Additions
+	SchemaVersion int // Version of the file format, only used at the top of single service files
+	Selection     int
+	Domains       string
+	CanonicalHost string // One of Domains, which is the only one served, the others are redirected to it
+	Root          string
+	PHPBackend    string // fastcgi_pass of the PHP and WordPress presets: a unix:/path socket or host:port, defaultPHPSocket when empty
+	URL           string
+	WSGI          WSGIConfig  // Application server of the wsgi preset
+	Upstream      Upstream    // Backend servers of the load-balance preset
+	Proxy         ProxyConfig // Settings of the proxy presets
+	Locations     []Location  // Paths routed to other handlers than the preset, in the order they are matched
+	Auth          AuthConfig  // HTTP basic authentication of the service or one of its Locations
+	Port          int
+	Additional    Additions
 }
 
 type Additions struct {
@@ -27,6 +34,9 @@ type Additions struct {
 	MakeDefaultServer bool
 	AddCachingConfig  bool
 	MaxCacheAge       string
+	TLS               TLSConfig
+	RedirectHTTP      bool   // Add a port 80 server block for Domains redirecting to https, for port 443 services
+	ChallengeWebroot  string // Serve /.well-known/acme-challenge/ from this directory in the RedirectHTTP block
 }
 
 var yellow = color.New(color.FgYellow)
@@ -34,49 +44,11 @@ var cyan = color.New(color.FgCyan)
 var red = color.New(color.FgRed)
 
 func main() {
-	if len(os.Args) > 1 {
-		pArg := os.Args[1]
-		if pArg == "-h" || pArg == "-help" || pArg == "--help" {
-			fmt.Println("nginx-auto-config is a program which allows you to create configurations for the nginx web server using a number of presets interactively\nLicensed under the MIT license, created by Sidharth Soni (Sid Sun)\nYou can find the source code at: https://github.com/Sid-Sun/nginx-auto-config")
-		} else if pArg == "-v" || pArg == "-version" || pArg == "--version" {
-			fmt.Println(version)
-		} else if fileExists(pArg) {
-			serverFileConf := readFromFile(pArg)
-			serviceFile := Service{}
-
-			if err := toml.Unmarshal(serverFileConf, &serviceFile); err != nil {
-				red.Println("Error occoured while reading config from", pArg, "Details: \n", err.Error())
-				os.Exit(1)
-			}
-
-			fileName, fileContents := prepareServiceFileContents(serviceFile)
-
-			fmt.Print(fileContents)
-			_, _ = cyan.Print("Is this correct? (Y[es]/n[o]): ")
-
-			if getConsent(true) {
-				if err := writeContentToFile(fileName+".conf", []byte(fileContents)); err != nil {
-					red.Println("Error occoured while writing config", fileName+".conf", "Details:\n", err.Error())
-					os.Exit(1)
-				}
-
-				fmt.Printf("Config written to %s, move it to the appropriate config folder and reload the nginx webserver, Enjoy!\n", fileName+".conf")
-				if serviceFile.Port == 443 {
-					printCautionSSL()
-				}
-			}
-
-		} else {
-			fmt.Printf(
-				"Unknown option: %s\n"+
-					"Run with -h, -help or --help to get help\n"+
-					"-v, -version or --version to get program version\n"+
-					"Or without any argumets to launch the program interactively\n", pArg)
-			os.Exit(1)
-		}
-		os.Exit(0)
-	}
+	os.Exit(runCLI(os.Args[1:]))
+}
 
+// runWizard creates a service by asking for its details interactively, returns the exit code
+func runWizard() int {
 	fmt.Println("-------------------------------------------------------------------------------")
 	fmt.Println("An interactive program to Automate nginx virtual server creation by Sid Sun")
 	fmt.Println("Licensed under the MIT License")
@@ -88,165 +60,316 @@ func main() {
 	testWritePermissions() // Test writing permissions before proceeding further, Functions exits the program if permissions lack
 
 	serviceConfig := getDetails()
+	for err := validateWizardService(serviceConfig); err != nil; err = validateWizardService(serviceConfig) {
+		for _, fieldError := range err.(ValidationErrors) {
+			_, _ = red.Println(fieldError.Error())
+		}
+		_, _ = yellow.Println("The details entered can not be used, let's try again")
+		serviceConfig = getDetails()
+	}
 
 	fileName, fileContents := prepareServiceFileContents(serviceConfig)
 	fmt.Print(fileContents)
 	_, _ = cyan.Print("Is this correct? (Y[es]/n[o]): ")
 
 	if getConsent(true) {
-		if data, err := toml.Marshal(serviceConfig); err != nil {
-			red.Println("Error occoured while converting config to toml. Details: \n", err.Error())
-			os.Exit(1)
-		} else {
-			err = writeContentToFile(fileName+".toml", data)
-			if err != nil {
-				red.Println("Error occoured while writing config", fileName+".toml", "Details:\n", err.Error())
-				os.Exit(1)
-			}
+		_, _, written, err := saveService(".", fileName, serviceConfig, fileContents, overwriteAsk)
+		if err != nil {
+			red.Println("Error occoured while writing config. Details:\n", err.Error())
+			return exitError
 		}
-
-		if err := writeContentToFile(fileName+".conf", []byte(fileContents)); err != nil {
-			red.Println("Error occoured while writing config", fileName+".conf", "Details:\n", err.Error())
-			os.Exit(1)
+		if !written {
+			return exitOK
 		}
 
 		fmt.Printf("Wrote service details to %s, run program with %s as argument to re-generate config!\n", fileName+".toml", fileName+".toml")
 		fmt.Printf("Config written to %s, move it to the appropriate config folder and reload the nginx webserver, Enjoy!\n", fileName+".conf")
+		if serviceConfig.usesWebSocket() {
+			if err := saveWebSocketSnippet(".", overwriteAsk); err != nil {
+				red.Println("Error occoured while writing config. Details:\n", err.Error())
+				return exitError
+			}
+		}
+
+		if serviceConfig.Auth.configured() {
+			setWizardPasswords(serviceConfig, fileName)
+		}
 
-		if serviceConfig.Port == 443 {
+		if serviceConfig.usesPlaceholderSSL() {
 			printCautionSSL()
 		}
 	}
+	return exitOK
+}
+
+// validateWizardService validates the service and checks its certificate files, which have to be on this machine
+func validateWizardService(server Service) error {
+	if err := server.Validate(); err != nil {
+		return err
+	}
+	return verifyTLSFiles(server)
 }
 
 func prepareServiceFileContents(server Service) (string, string) {
-	fileName := strings.Fields(server.Domains)[0]
-	output := "server {"
-	newLine := "\n    "
-	ipv4listenString := "listen " + strconv.Itoa(server.Port)
-	ipv6listenString := "listen [::]:" + strconv.Itoa(server.Port)
-	if server.Additional.MakeDefaultServer {
-		ipv4listenString += " default_server"
-		ipv6listenString += " default_server"
+	fileName, blocks := buildServerBlocks(server)
+	return fileName, printConfig(blocks...)
+}
+
+// buildServerBlocks returns the server block of the service with the blocks accompanying it: the upstream of the
+// load-balance preset before it, the redirects of the aliases of the CanonicalHost and the RedirectHTTP block after it
+func buildServerBlocks(server Service) (string, []Node) {
+	fileName, block := buildServerBlock(server)
+	blocks := []Node{block}
+	if server.Selection == 9 {
+		blocks = []Node{buildUpstreamBlock(upstreamName(fileName), server.Upstream), block}
 	}
-	if server.Port == 443 {
-		ipv4listenString += " ssl"
-		ipv6listenString += " ssl"
-		ipv4listenString = "#" + ipv4listenString
-		ipv6listenString = "#" + ipv6listenString
-	}
-	ipv4listenString += " http2;"
-	ipv6listenString += " http2;"
-	output += newLine + ipv4listenString
-	output += newLine + ipv6listenString
-	output += newLine + "server_name " + server.Domains + ";"
-	output += newLine + "access_log off;"
-	output += newLine + "error_log /dev/null crit;"
-	if server.Port == 443 {
-		output += newLine + "#ssl_protocols TLSv1.2 TLSv1.3;"
-		output += newLine + "#ssl_certificate /etc/letsencrypt/live/" + fileName + "/fullchain.pem;"
-		output += newLine + "#ssl_certificate_key /etc/letsencrypt/live/" + fileName + "/privkey.pem;"
+	if aliases := server.aliases(); len(aliases) > 0 {
+		aliasBlock := newBlock("server").add(listenDirectives(server, false)...)
+		aliasBlock.add(newDirective("server_name", aliases...))
+		if server.usesSSL() {
+			aliasBlock.add(server.Additional.TLS.directives(fileName)...)
+		}
+		blocks = append(blocks, aliasBlock.add(newDirective("return", "308", server.canonicalURL())))
+		if server.Port == 443 {
+			blocks = append(blocks, buildHTTPRedirectBlock(aliases, server.canonicalURL(), server.Additional.ChallengeWebroot))
+		}
+	}
+	if server.Additional.RedirectHTTP {
+		blocks = append(blocks, buildHTTPRedirectBlock(strings.Fields(server.servedNames()), "https://$host$request_uri", server.Additional.ChallengeWebroot))
+	}
+	return fileName, blocks
+}
+
+// buildHTTPRedirectBlock creates a port 80 server block redirecting names to target, the ACME challenge path is
+// served from webroot first when it is set
+func buildHTTPRedirectBlock(names []string, target string, webroot string) *Directive {
+	block := newBlock("server").add(
+		newDirective("listen", "80"),
+		newDirective("listen", "[::]:80"),
+		newDirective("server_name", names...),
+	)
+	redirect := newDirective("return", "308", target)
+	if webroot == "" {
+		return block.add(redirect)
+	}
+	return block.add(
+		acmeChallengeLocation(webroot),
+		newBlock("location", "/").add(redirect),
+	)
+}
+
+// usesSSL reports whether the server listens with ssl, either with a certificate or with the commented placeholders
+func (server Service) usesSSL() bool {
+	return server.Port == 443 || server.Additional.TLS.configured()
+}
+
+// servedNames returns the server_name of the main block: the CanonicalHost when set, otherwise all Domains
+func (server Service) servedNames() string {
+	if server.CanonicalHost != "" {
+		return server.CanonicalHost
+	}
+	return server.Domains
+}
+
+// aliases returns the Domains redirected to the CanonicalHost
+func (server Service) aliases() []string {
+	if server.CanonicalHost == "" {
+		return nil
+	}
+	var aliases []string
+	for _, domain := range strings.Fields(server.Domains) {
+		if domain != server.CanonicalHost {
+			aliases = append(aliases, domain)
+		}
+	}
+	return aliases
+}
+
+// canonicalURL is where the aliases are redirected to, the port is left out when it is the default of the scheme
+func (server Service) canonicalURL() string {
+	scheme, defaultPort := "http", 80
+	if server.usesSSL() {
+		scheme, defaultPort = "https", 443
+	}
+	host := server.CanonicalHost
+	if server.Port != defaultPort {
+		host += ":" + strconv.Itoa(server.Port)
+	}
+	return scheme + "://" + host + "$request_uri"
+}
+
+// listenDirectives returns the IPv4 and IPv6 listen directives of server, commented out with placeholder SSL
+func listenDirectives(server Service, defaultServer bool) []Node {
+	listenArgs := []string{}
+	if defaultServer {
+		listenArgs = append(listenArgs, "default_server")
+	}
+	if server.usesSSL() {
+		listenArgs = append(listenArgs, "ssl")
+	}
+	listenArgs = append(listenArgs, "http2")
+	ipv4listen := newDirective("listen", append([]string{strconv.Itoa(server.Port)}, listenArgs...)...)
+	ipv6listen := newDirective("listen", append([]string{"[::]:" + strconv.Itoa(server.Port)}, listenArgs...)...)
+	ipv4listen.Commented = server.usesPlaceholderSSL()
+	ipv6listen.Commented = server.usesPlaceholderSSL()
+	return []Node{ipv4listen, ipv6listen}
+}
+
+// insertLocations adds the blocks of locations to nodes before the first location the preset added from index start,
+// so the regexes of locations are matched before the ones of the preset
+func insertLocations(nodes []Node, start int, locations []Location) []Node {
+	for start < len(nodes) {
+		if directive, ok := nodes[start].(*Directive); ok && directive.Name == "location" {
+			break
+		}
+		start++
+	}
+	inserted := append([]Node{}, nodes[:start]...)
+	for _, location := range locations {
+		inserted = append(inserted, buildLocation(location))
+	}
+	return append(inserted, nodes[start:]...)
+}
+
+// buildServerBlock converts a Service into the server block it describes, along with the name for its files
+func buildServerBlock(server Service) (string, *Directive) {
+	fileName := strings.Fields(server.Domains)[0]
+	block := newBlock("server")
+	block.add(listenDirectives(server, server.Additional.MakeDefaultServer)...)
+	block.add(newDirective("server_name", server.servedNames()))
+	block.add(newDirective("access_log", "off"))
+	block.add(newDirective("error_log", "/dev/null", "crit"))
+	if server.usesSSL() {
+		block.add(server.Additional.TLS.directives(fileName)...)
 	}
 	if server.Additional.AddHSTSConfig {
-		output += newLine + "#Send HSTS header"
-		output += newLine + "add_header Strict-Transport-Security \"max-age=31536000; includeSubDomains; preload\";"
+		block.add(Comment("Send HSTS header"))
+		block.add(newDirective("add_header", "Strict-Transport-Security", `"max-age=31536000; includeSubDomains; preload"`))
+	}
+	if server.Auth.configured() && server.Auth.Path == "" {
+		block.add(server.Auth.directives(fileName)...)
 	}
+	presetStart := len(block.Block)
 	switch server.Selection {
 	case 1:
-		output += newLine + "root " + server.Root + ";"
-		output += newLine + "location / {"
-		output += newLine + "    index index.html;"
-		output += newLine + "}"
+		block.add(newDirective("root", server.Root))
+		block.add(newBlock("location", "/").add(
+			newDirective("index", "index.html"),
+		))
 	case 2:
-		output += newLine + "location / {"
-		output += newLine + "    root " + server.Root + ";"
-		output += newLine + "}"
+		block.add(newBlock("location", "/").add(
+			newDirective("root", server.Root),
+		))
 	case 3:
-		output += newLine + "root " + server.Root + ";"
-		output += newLine + "index index.html;"
-		output += newLine + "location / {"
-		output += newLine + "    try_files $uri $uri/ @rewrites;"
-		output += newLine + "}"
-		output += newLine + "location @rewrites {"
-		output += newLine + "    rewrite ^(.+)$ /index.html last;"
-		output += newLine + "}"
+		block.add(newDirective("root", server.Root))
+		block.add(newDirective("index", "index.html"))
+		block.add(newBlock("location", "/").add(
+			newDirective("try_files", "$uri", "$uri/", "@rewrites"),
+		))
+		block.add(newBlock("location", "@rewrites").add(
+			newDirective("rewrite", "^(.+)$", "/index.html", "last"),
+		))
 	case 4:
-		output += newLine + "root " + server.Root + ";"
-		output += newLine + "index index.php;"
-		output += newLine + "location / {"
-		output += newLine + "    try_files $uri $uri/ =404;"
-		output += newLine + "    autoindex  on;"
-		output += newLine + "    autoindex_exact_size off;"
-		output += newLine + "    autoindex_localtime on;"
-		output += newLine + "}"
-		output += newLine + "location ~* \\.php$ {"
-		output += newLine + "    include snippets/fastcgi-php.conf;"
-		output += newLine + "    fastcgi_pass  unix:/var/run/php/php7.2-fpm.sock;"
-		output += newLine + "}"
-	case 5, 7:
-		output += newLine + "location / {"
-		output += newLine + "    proxy_pass " + server.URL + ";"
-		output += newLine + "    proxy_read_timeout  90;"
-		output += newLine + "}"
+		block.add(newDirective("root", server.Root))
+		block.add(newDirective("index", "index.php"))
+		block.add(newBlock("location", "/").add(
+			newDirective("try_files", "$uri", "$uri/", "=404"),
+			&Directive{Name: "autoindex", Args: []string{"on"}, Separator: "  "},
+			newDirective("autoindex_exact_size", "off"),
+			newDirective("autoindex_localtime", "on"),
+		))
+		block.add(buildPHPLocation("~*", server.PHPBackend))
+	case 5, 7, 9:
+		proxy := server.URL
+		if server.Selection == 9 {
+			proxy = "http://" + upstreamName(fileName)
+		}
+		block.add(buildProxyLocations(proxy, server.Proxy, server.Selection == 9 && server.Upstream.Keepalive > 0)...)
 	case 6:
-		output += newLine + "return 308 " + server.URL + ";"
+		block.add(newDirective("return", "308", server.URL))
+	case 10:
+		block.add(buildGRPCLocations(server.URL, server.Proxy)...)
+	case 11:
+		block.add(buildWSGILocations(server.WSGI)...)
+	case 12:
+		block.add(newDirective("root", server.Root))
+		block.add(newDirective("index", "index.php"))
+		block.add(buildWordPressLocations(server.PHPBackend)...)
 	case 8:
 		fileName = "default"
-		output += newLine + "return 308 https://$host$request_uri;"
+		block.add(newDirective("return", "308", "https://$host$request_uri"))
+	}
+	if len(server.Locations) > 0 {
+		block.Block = insertLocations(block.Block, presetStart, server.Locations)
+	}
+	if server.Auth.Path != "" {
+		addAuth(block, server.Auth, fileName)
 	}
 	if server.Additional.AddSecurityConfig {
-		output += newLine + "#Turn off nginx version number displayed on all auto generated error pages"
-		output += newLine + "server_tokens off;"
-		output += newLine + "#Controlling Buffer Overflow Attacks"
-		output += newLine + "#Start: Size Limits & Buffer Overflows"
-		output += newLine + "client_body_buffer_size 1K;"
-		output += newLine + "client_header_buffer_size 1k;"
-		output += newLine + "client_max_body_size 1k;"
-		output += newLine + "large_client_header_buffers 2 1k;"
-		output += newLine + "#END: Size Limits & Buffer Overflows"
-		output += newLine + "#Start: Timeouts"
-		output += newLine + "client_body_timeout 10;"
-		output += newLine + "client_header_timeout 10;"
-		output += newLine + "keepalive_timeout 5 5;"
-		output += newLine + "send_timeout 10;"
-		output += newLine + "#End: Timeout"
-		output += newLine + "#Avoid clickjacking"
-		output += newLine + "add_header X-Frame-Options SAMEORIGIN;"
-		output += newLine + "#Disable content-type sniffing on some browsers"
-		output += newLine + "add_header X-Content-Type-Options nosniff;"
-		output += newLine + "#Enable the Cross-site scripting (XSS) filter"
-		output += newLine + "add_header X-XSS-Protection \"1; mode=block\";"
+		block.add(
+			Comment("Turn off nginx version number displayed on all auto generated error pages"),
+			newDirective("server_tokens", "off"),
+			Comment("Controlling Buffer Overflow Attacks"),
+			Comment("Start: Size Limits & Buffer Overflows"),
+			newDirective("client_body_buffer_size", "1K"),
+			newDirective("client_header_buffer_size", "1k"),
+			newDirective("client_max_body_size", "1k"),
+			newDirective("large_client_header_buffers", "2", "1k"),
+			Comment("END: Size Limits & Buffer Overflows"),
+			Comment("Start: Timeouts"),
+			newDirective("client_body_timeout", "10"),
+			newDirective("client_header_timeout", "10"),
+			newDirective("keepalive_timeout", "5", "5"),
+			newDirective("send_timeout", "10"),
+			Comment("End: Timeout"),
+			Comment("Avoid clickjacking"),
+			newDirective("add_header", "X-Frame-Options", "SAMEORIGIN"),
+			Comment("Disable content-type sniffing on some browsers"),
+			newDirective("add_header", "X-Content-Type-Options", "nosniff"),
+			Comment("Enable the Cross-site scripting (XSS) filter"),
+			newDirective("add_header", "X-XSS-Protection", `"1; mode=block"`),
+		)
 	}
 	if server.Additional.AddCachingConfig {
-		output += newLine + "location ~* \\.(js|css|json|png|jpg|jpeg|gif|ico)$ {"
 		if server.Additional.MaxCacheAge == "" {
 			server.Additional.MaxCacheAge = "6h"
 		}
-		output += newLine + "    expires " + server.Additional.MaxCacheAge + ";"
-		output += newLine + "    add_header Cache-Control \"public, no-transform\";"
-		output += newLine + "}"
+		block.add(newBlock("location", "~*", `\.(js|css|json|png|jpg|jpeg|gif|ico)$`).add(
+			newDirective("expires", server.Additional.MaxCacheAge),
+			newDirective("add_header", "Cache-Control", `"public, no-transform"`),
+		))
 	}
-	output += "\n}\n" //End server block and add newline at EOF
-	return fileName, output
+	return fileName, block
 }
 
 func getDetails() Service {
 	var server Service
 
 	server.Selection = takeInput()
+	if server.Selection == exitSelection {
+		os.Exit(0)
+	}
 	server.Port = 443
 
-	if inRange(server.Selection, []int{1, 2, 3, 4, 5, 6, 7}) {
+	if inRange(server.Selection, []int{1, 2, 3, 4, 5, 6, 7, 9, 10, 11, 12}) {
 		fmt.Println("Enter the domain/sub-domain name(s) (separated by space and without ending semicolon)")
 		_, _ = cyan.Print("Server Names: ")
 		inputConfig := newInputConfig(false, false, "Server Names: ")
 		server.Domains = getInput(inputConfig)
+		if len(strings.Fields(server.Domains)) > 1 {
+			fmt.Println("Enter the canonical name to redirect the other names to (EX: sidsun.com for www.sidsun.com), leave it empty to serve all of them")
+			_, _ = cyan.Print("Canonical name: ")
+			server.CanonicalHost = getInput(newInputConfig(true, true, ""))
+		}
 	}
 
 	if inRange(server.Selection, []int{1, 2, 3, 4}) {
 		fmt.Println("Enter the path where the files are (root path for virtual server)")
 		_, _ = cyan.Print("Root path: ")
 		server.Root = getRootPath()
+		if server.Selection == 4 {
+			server.PHPBackend = getPHPBackend()
+		}
 		fmt.Print("Do you want to leverage caching?")
 		_, _ = cyan.Print("\nSetup Caching (Y[es]/n[o]): ")
 		server.Additional.AddCachingConfig = getConsent(true)
@@ -269,20 +392,57 @@ func getDetails() Service {
 		server.URL = getInput(inputConfig)
 	}
 
+	if server.Selection == 9 {
+		server.Upstream = getUpstreamDetails()
+	}
+
+	if server.Selection == 10 {
+		fmt.Println("Enter the gRPC backend (EX: grpc://127.0.0.1:50051, or grpcs:// when it uses TLS)")
+		_, _ = cyan.Print("gRPC backend: ")
+		server.URL = getInput(newInputConfig(false, true, "gRPC backend: "))
+		fmt.Printf("Enter how long calls may wait for the backend to read or send (EX: 30s, 5m), leave it empty for %s to keep streams open\n", defaultGRPCTimeout)
+		_, _ = cyan.Print("Stream timeout: ")
+		server.Proxy.ReadTimeout = getInput(newInputConfig(true, true, ""))
+		server.Proxy.SendTimeout = server.Proxy.ReadTimeout
+	}
+
+	if server.Selection == 11 {
+		server.WSGI = getWSGIDetails()
+	}
+
+	if server.Selection == 12 {
+		fmt.Println("Enter the path WordPress is installed at (root path for virtual server)")
+		_, _ = cyan.Print("Root path: ")
+		server.Root = getRootPath()
+		server.PHPBackend = getPHPBackend()
+	}
+
 	if server.Selection == 7 {
 		fmt.Println("Enter the port number the virtual server should listen to")
 		_, _ = cyan.Print("Port: ")
 		server.Port = getInt(false, "Port: ")
 	}
 
+	if inRange(server.Selection, []int{5, 7, 9}) {
+		server.Proxy = getProxyDetails()
+	}
+
 	if server.Selection == 8 {
 		server.Additional.MakeDefaultServer = true
 		server.Domains = "_"
 		server.Port = 80
 	}
 
-	if server.Selection == 9 {
-		os.Exit(0)
+	if !inRange(server.Selection, []int{6, 8}) {
+		server.Locations = getLocations()
+		server.Auth = getAuthDetails(server.Locations)
+	}
+
+	if server.Port == 443 {
+		server.Additional.TLS = getTLSDetails()
+		fmt.Print("Do you want HTTP requests for these domains to be redirected to HTTPS?")
+		_, _ = cyan.Print("\nRedirect HTTP to HTTPS (Y[es]/n[o]): ")
+		server.Additional.RedirectHTTP = getConsent(true)
 	}
 
 	fmt.Print("Do you want the virtual server to send HSTS preload header with the response?")
@@ -296,22 +456,287 @@ func getDetails() Service {
 	return server
 }
 
+// getTLSDetails asks where the certificate of an HTTPS server is, an empty TLSConfig leaves the SSL directives commented out
+func getTLSDetails() TLSConfig {
+	var config TLSConfig
+	fmt.Println("Where is the certificate for the virtual server? (1) Let's Encrypt (certbot) (2) Certificate and key files (3) Fill in later")
+	_, _ = cyan.Print("Certificate: ")
+	switch getInt(false, "Certificate: ") {
+	case 1:
+		config.LetsEncrypt = true
+	case 2:
+		_, _ = cyan.Print("Certificate path: ")
+		config.Certificate = getInput(newInputConfig(false, true, "Certificate path: "))
+		_, _ = cyan.Print("Key path: ")
+		config.Key = getInput(newInputConfig(false, true, "Key path: "))
+		_, _ = cyan.Print("Chain path (empty for none): ")
+		config.Chain = getInput(newInputConfig(true, true, ""))
+	}
+	config.Profile = getTLSProfile()
+	return config
+}
+
+// getTLSProfile asks for the Mozilla SSL profile, defaulting to intermediate
+func getTLSProfile() string {
+	fmt.Println("Which SSL profile should the virtual server use?")
+	for _, profile := range tlsProfiles {
+		fmt.Printf("%s - %s\n", profile.Name, profile.Description)
+	}
+	_, _ = cyan.Print("SSL profile (empty for intermediate): ")
+	name := getInput(newInputConfig(true, true, ""))
+	if name == "" {
+		return "intermediate"
+	}
+	if _, ok := tlsProfileByName(name); !ok {
+		fmt.Println("Enter one of", tlsProfileNameList())
+		return getTLSProfile()
+	}
+	return name
+}
+
+// getUpstreamDetails asks for the backend servers of the load-balance preset and how to balance between them
+func getUpstreamDetails() Upstream {
+	var upstream Upstream
+	fmt.Println("Enter the backend servers one per line, optionally followed by their parameters (EX: 127.0.0.1:8000 weight=2 max_fails=3 fail_timeout=30s backup), leave it empty when done")
+	for {
+		_, _ = cyan.Print("Backend server: ")
+		input := getInput(newInputConfig(true, false, ""))
+		if strings.TrimSpace(input) == "" {
+			if len(upstream.Servers) > 0 {
+				break
+			}
+			fmt.Println("At least one backend server is required")
+			continue
+		}
+		server, err := parseUpstreamServer(strings.Fields(input))
+		if err != nil {
+			_, _ = red.Println(err.Error())
+			continue
+		}
+		upstream.Servers = append(upstream.Servers, server)
+	}
+	fmt.Println("How should requests be balanced between them?", strings.Join(upstreamMethods, ", "))
+	_, _ = cyan.Print("Balancing method (empty for round-robin): ")
+	upstream.Method = getInput(newInputConfig(true, true, ""))
+	if upstream.Method == "round-robin" {
+		upstream.Method = ""
+	}
+	if upstream.Method == "hash" {
+		fmt.Println("Enter the key to hash (EX: $request_uri or $remote_addr)")
+		_, _ = cyan.Print("Hash key: ")
+		upstream.HashKey = strings.TrimSpace(getInput(newInputConfig(false, false, "Hash key: ")))
+	}
+	fmt.Println("How many idle connections to the backend servers should each worker keep open?")
+	for {
+		_, _ = cyan.Print("Keepalive connections (empty for none): ")
+		input := getInput(newInputConfig(true, true, ""))
+		if input == "" {
+			break
+		}
+		keepalive, err := strconv.Atoi(input)
+		if err == nil && keepalive >= 0 {
+			upstream.Keepalive = keepalive
+			break
+		}
+		_, _ = red.Println("Please enter a number")
+	}
+	return upstream
+}
+
+// getProxyDetails asks for the settings of the proxy presets, everything but the forwarded headers defaults to nginx
+func getProxyDetails() ProxyConfig {
+	var config ProxyConfig
+	fmt.Printf("Do you want the %s headers to be sent to the backend?", forwardedHeaderNames())
+	_, _ = cyan.Print("\nForward headers (Y[es]/n[o]): ")
+	config.ForwardHeaders = getConsent(true)
+	fmt.Print("Does the backend use WebSockets?")
+	_, _ = cyan.Print("\nProxy WebSockets (y[es]/N[o]): ")
+	if getConsent(false) {
+		fmt.Println("Enter the paths using WebSockets separated by space (EX: /socket.io/ /ws), leave it empty for all requests")
+		_, _ = cyan.Print("WebSocket paths: ")
+		config.WebSocketPaths = strings.Fields(getInput(newInputConfig(true, false, "")))
+		config.WebSocket = len(config.WebSocketPaths) == 0
+	}
+	fmt.Print("Do you want to change the timeouts, buffering or request body size of the proxy?")
+	_, _ = cyan.Print("\nCustomize proxy (y[es]/N[o]): ")
+	if !getConsent(false) {
+		return config
+	}
+	_, _ = cyan.Print("Connect timeout [30s/1m] (empty for 60s): ")
+	config.ConnectTimeout = getInput(newInputConfig(true, true, ""))
+	_, _ = cyan.Print("Send timeout [30s/1m] (empty for 60s): ")
+	config.SendTimeout = getInput(newInputConfig(true, true, ""))
+	_, _ = cyan.Print("Read timeout [30s/5m] (empty for 90s): ")
+	config.ReadTimeout = getInput(newInputConfig(true, true, ""))
+	fmt.Print("Should responses be passed to the client as they arrive? (for streaming and server-sent events)")
+	_, _ = cyan.Print("\nDisable buffering (y[es]/N[o]): ")
+	config.DisableBuffering = getConsent(false)
+	_, _ = cyan.Print("Max request body size [512k/10m/1g] (empty for 1m): ")
+	config.MaxBodySize = getInput(newInputConfig(true, true, ""))
+	return config
+}
+
+// getWSGIDetails asks for the application server of the wsgi preset and the directories of its static and media files
+func getWSGIDetails() WSGIConfig {
+	var config WSGIConfig
+	fmt.Println("Which application server runs the app?", strings.Join(wsgiServers, ", "))
+	_, _ = cyan.Print("Application server (empty for uwsgi): ")
+	config.Server = getInput(newInputConfig(true, true, ""))
+	if config.Server == "uwsgi" {
+		config.Server = ""
+	}
+	fmt.Println("Enter the socket path or host:port it listens on (EX: /run/uwsgi/app.sock or 127.0.0.1:8000)")
+	_, _ = cyan.Print("Application socket: ")
+	config.Socket = getInput(newInputConfig(false, true, "Application socket: "))
+	if strings.HasPrefix(config.Socket, "/") {
+		config.Socket = "unix:" + config.Socket
+	}
+	fmt.Println("Enter the directory to serve /static/ from (EX: STATIC_ROOT of Django), leave it empty if there is none")
+	_, _ = cyan.Print("Static files: ")
+	if static := getInput(newInputConfig(true, true, "")); static != "" {
+		config.Static = getAbsolutePath(static)
+	}
+	fmt.Println("Enter the directory to serve /media/ from (EX: MEDIA_ROOT of Django), leave it empty if there is none")
+	_, _ = cyan.Print("Media files: ")
+	if media := getInput(newInputConfig(true, true, "")); media != "" {
+		config.Media = getAbsolutePath(media)
+	}
+	return config
+}
+
+// getAuthDetails asks whether credentials are needed to access the service or one of its locations, and for the users
+func getAuthDetails(locations []Location) AuthConfig {
+	var config AuthConfig
+	fmt.Print("Do you want to ask for a user name and password before serving the site? (HTTP basic auth)")
+	_, _ = cyan.Print("\nBasic authentication (y[es]/N[o]): ")
+	if !getConsent(false) {
+		return config
+	}
+	fmt.Println("Enter the users separated by space (EX: alice bob)")
+	_, _ = cyan.Print("Users: ")
+	config.Users = strings.Fields(getInput(newInputConfig(false, false, "Users: ")))
+	fmt.Println("Enter the realm browsers show when asking for the credentials")
+	_, _ = cyan.Printf("Realm (empty for %s): ", defaultAuthRealm)
+	config.Realm = strings.TrimSpace(getInput(newInputConfig(true, false, "")))
+	if len(locations) > 0 {
+		fmt.Println("Enter the path of one of the locations to only protect it, leave it empty to protect the whole site")
+		_, _ = cyan.Print("Protected path: ")
+		config.Path = getInput(newInputConfig(true, true, ""))
+	}
+	return config
+}
+
+// setWizardPasswords offers to set the passwords of the users of the service in its htpasswd file right away
+func setWizardPasswords(server Service, fileName string) {
+	userFile := server.Auth.userFile(fileName)
+	fmt.Printf("Do you want to set the passwords of the users in %s now?", userFile)
+	_, _ = cyan.Print("\nSet passwords (Y[es]/n[o]): ")
+	if !getConsent(true) {
+		fmt.Printf("Run the program with htpasswd %s as arguments to set them later\n", fileName+".toml")
+		return
+	}
+	passwords := map[string]string{}
+	for _, user := range server.Auth.Users {
+		password, err := getPassword(user)
+		if err != nil {
+			red.Println("Error occoured while reading the password. Details:\n", err.Error())
+			return
+		}
+		passwords[user] = password
+	}
+	if err := updateHtpasswd(userFile, server.Auth.Users, passwords, "bcrypt"); err != nil {
+		red.Println("Error occoured while writing the passwords. Details:\n", err.Error())
+		fmt.Printf("Run the program with htpasswd %s as arguments to set them later\n", fileName+".toml")
+		return
+	}
+	fmt.Println("Wrote the passwords to", userFile)
+}
+
+// getPHPBackend offers the PHP-FPM sockets found on this machine, a host:port or socket path can be entered as well
+func getPHPBackend() string {
+	sockets := findPHPSockets()
+	fmt.Println("Which PHP-FPM should run the PHP files?")
+	for i, socket := range sockets {
+		fmt.Printf("(%d) %s\n", i+1, socket)
+	}
+	fallback := defaultPHPSocket
+	if len(sockets) > 0 {
+		fallback = "unix:" + sockets[0]
+	}
+	fmt.Printf("Enter a number, a socket path or a host:port (EX: 127.0.0.1:9000), leave it empty for %s\n", fallback)
+	_, _ = cyan.Print("PHP-FPM: ")
+	input := getInput(newInputConfig(true, true, ""))
+	if number, err := strconv.Atoi(input); err == nil && number >= 1 && number <= len(sockets) {
+		return "unix:" + sockets[number-1]
+	}
+	switch {
+	case input == "" && len(sockets) == 0:
+		return ""
+	case input == "":
+		return fallback
+	case strings.HasPrefix(input, "/"):
+		return "unix:" + input
+	}
+	return input
+}
+
+// getLocations asks for the paths routed to other handlers than the preset, in the order they are matched
+func getLocations() []Location {
+	fmt.Print("Do you want to route some paths to other handlers? (EX: /api/ to a proxy, /static/ to files)")
+	_, _ = cyan.Print("\nAdd locations (y[es]/N[o]): ")
+	if !getConsent(false) {
+		return nil
+	}
+	var locations []Location
+	for {
+		fmt.Println("Enter the path (EX: /api/), prefix it with = for an exact match or ~ for a regex, leave it empty when done")
+		_, _ = cyan.Print("Location: ")
+		fields := strings.Fields(getInput(newInputConfig(true, false, "")))
+		if len(fields) == 0 {
+			return locations
+		}
+		location := Location{Match: "prefix", Path: fields[len(fields)-1]}
+		if len(fields) > 1 {
+			for _, matcher := range locationMatchers {
+				if matcher.Modifier == fields[0] {
+					location.Match = matcher.Name
+				}
+			}
+		}
+		for _, p := range presets[:6] {
+			fmt.Printf("(%d) %s\n", p.Selection, p.Title)
+		}
+		_, _ = cyan.Print("Serve it with: ")
+		location.Selection = getInt(false, "Serve it with: ")
+		if inRange(location.Selection, []int{5, 6}) {
+			_, _ = cyan.Print("Resource to proxy or redirect to: ")
+			location.URL = getInput(newInputConfig(false, true, "Resource to proxy or redirect to: "))
+		} else {
+			_, _ = cyan.Print("Root path: ")
+			location.Root = getRootPath()
+		}
+		if location.Selection == 4 {
+			location.PHPBackend = getPHPBackend()
+		}
+		locations = append(locations, location)
+	}
+}
+
 func takeInput() int {
 	_, _ = yellow.Print("Options: \n")
-	fmt.Println("(1) Static website hosting - Host a static website")
-	fmt.Println("(2) Host files without index - Host files without an index")
-	fmt.Println("(3) Host a routed webapp - Host a React/Angular/Vue webapp")
-	fmt.Println("(4) PHP Website hosting - Host a PHP site with fastcgi and php-fpm")
-	fmt.Println("(5) Proxy requests - Proxy incoming requests to a port or a website")
-	fmt.Println("(6) Permanent URL redirection - Redirect all incoming requests to an address")
-	fmt.Println("(7) Proxy with custom port - Proxy incoming requests at a port to an address")
-	fmt.Println("(8) HTTP requests to HTTPS redirect - Redirects all incoming HTTP traffic to HTTPS (use as default config)")
-	fmt.Println("(9) Exit")
+	for _, p := range presets {
+		fmt.Printf("(%d) %s - %s\n", p.Selection, p.Title, p.Description)
+	}
+	fmt.Printf("(%d) Exit\n", exitSelection)
 	_, _ = cyan.Print("What do you want to do: ")
 	input := getInt(false, "What do you want to do: ")
-	if input > 9 || input <= 0 {
+	if input < exitSelection || input > presets[len(presets)-1].Selection {
 		fmt.Println("Enter a valid number.")
 		return takeInput()
 	}
 	return input
 }
+
+// exitSelection is the menu option exiting the wizard, it was 9 until the presets after 8 took that number and stays 0
+// so adding presets doesn't move it again
+const exitSelection = 0
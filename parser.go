@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenEnd
+	tokenComment
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// tokenize splits nginx config source into words, braces, semicolons and comments
+// Quoted strings are kept as a single word including their quotes so they print back unchanged
+func tokenize(data []byte) ([]token, error) {
+	var tokens []token
+	src := []rune(string(data))
+	line := 1
+	for i := 0; i < len(src); i++ {
+		switch char := src[i]; {
+		case char == '\n':
+			line++
+		case char == ' ' || char == '\t' || char == '\r':
+		case char == '#':
+			start := i + 1
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenComment, text: strings.TrimRight(string(src[start:i+1]), "\r"), line: line})
+		case char == '{':
+			tokens = append(tokens, token{kind: tokenOpen, text: "{", line: line})
+		case char == '}':
+			tokens = append(tokens, token{kind: tokenClose, text: "}", line: line})
+		case char == ';':
+			tokens = append(tokens, token{kind: tokenEnd, text: ";", line: line})
+		case char == '"' || char == '\'':
+			start, startLine := i, line
+			for i++; i < len(src) && src[i] != char; i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", startLine)
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(src[start : i+1]), line: startLine})
+		default:
+			start := i
+			for ; i < len(src); i++ {
+				if src[i] == '\\' {
+					i++
+					continue
+				}
+				if src[i] == '$' && i+1 < len(src) && src[i+1] == '{' {
+					for i < len(src) && src[i] != '}' {
+						i++
+					}
+					continue
+				}
+				if strings.ContainsRune(" \t\r\n{};", src[i]) {
+					break
+				}
+			}
+			if i > len(src) {
+				i = len(src)
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(src[start:i]), line: line})
+			i--
+		}
+	}
+	return tokens, nil
+}
+
+// parseConfig reads nginx config source into a tree of nodes
+// A comment which holds a single simple directive (ex: #listen 443 ssl;) is parsed as a commented Directive
+func parseConfig(data []byte) ([]Node, error) {
+	tokens, err := tokenize(data)
+	if err != nil {
+		return nil, err
+	}
+	nodes, _, err := parseNodes(tokens, false)
+	return nodes, err
+}
+
+func parseNodes(tokens []token, inBlock bool) ([]Node, []token, error) {
+	nodes := []Node{}
+	for len(tokens) > 0 {
+		current := tokens[0]
+		switch current.kind {
+		case tokenClose:
+			if !inBlock {
+				return nil, nil, fmt.Errorf("line %d: unexpected \"}\"", current.line)
+			}
+			return nodes, tokens[1:], nil
+		case tokenComment:
+			nodes = append(nodes, parseComment(current))
+			tokens = tokens[1:]
+		case tokenOpen, tokenEnd:
+			return nil, nil, fmt.Errorf("line %d: unexpected %q", current.line, current.text)
+		case tokenWord:
+			directive := &Directive{Name: current.text, Line: current.line}
+			tokens = tokens[1:]
+			for len(tokens) > 0 && tokens[0].kind == tokenWord {
+				directive.Args = append(directive.Args, tokens[0].text)
+				tokens = tokens[1:]
+			}
+			if len(tokens) == 0 {
+				return nil, nil, fmt.Errorf("line %d: directive %q is not terminated by \";\"", current.line, current.text)
+			}
+			switch tokens[0].kind {
+			case tokenEnd:
+				tokens = tokens[1:]
+			case tokenOpen:
+				block, rest, err := parseNodes(tokens[1:], true)
+				if err != nil {
+					return nil, nil, err
+				}
+				directive.Block = block
+				tokens = rest
+			case tokenComment:
+				return nil, nil, fmt.Errorf("line %d: directive %q is not terminated by \";\"", current.line, current.text)
+			default:
+				return nil, nil, fmt.Errorf("line %d: unexpected %q", tokens[0].line, tokens[0].text)
+			}
+			nodes = append(nodes, directive)
+		}
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("unexpected end of file, expecting \"}\"")
+	}
+	return nodes, nil, nil
+}
+
+func parseComment(comment token) Node {
+	text := strings.TrimSpace(comment.text)
+	if !strings.HasSuffix(text, ";") {
+		return Comment(comment.text)
+	}
+	tokens, err := tokenize([]byte(text))
+	if err != nil || len(tokens) < 2 || tokens[0].kind != tokenWord || tokens[len(tokens)-1].kind != tokenEnd {
+		return Comment(comment.text)
+	}
+	directive := &Directive{Name: tokens[0].text, Commented: true, Line: comment.line}
+	for _, word := range tokens[1 : len(tokens)-1] {
+		if word.kind != tokenWord {
+			return Comment(comment.text)
+		}
+		directive.Args = append(directive.Args, word.text)
+	}
+	return directive
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		source        string
+		expectedNodes []Node
+		expectedError string
+	}{
+		{
+			name: "test parse nested blocks with quoted arguments and variables",
+			source: `server {
+    listen 80;
+    add_header X-XSS-Protection "1; mode=block";
+    location ~ ^/(${prefix})$ {
+        return 308 https://$host$request_uri;
+    }
+}`,
+			expectedNodes: []Node{
+				&Directive{Name: "server", Line: 1, Block: []Node{
+					&Directive{Name: "listen", Args: []string{"80"}, Line: 2},
+					&Directive{Name: "add_header", Args: []string{"X-XSS-Protection", `"1; mode=block"`}, Line: 3},
+					&Directive{Name: "location", Args: []string{"~", "^/(${prefix})$"}, Line: 4, Block: []Node{
+						&Directive{Name: "return", Args: []string{"308", "https://$host$request_uri"}, Line: 5},
+					}},
+				}},
+			},
+		},
+		{
+			name:   "test parse comments and commented directives",
+			source: "#Send HSTS header\n#listen 443 ssl http2;\nevents {}\n",
+			expectedNodes: []Node{
+				Comment("Send HSTS header"),
+				&Directive{Name: "listen", Args: []string{"443", "ssl", "http2"}, Commented: true, Line: 2},
+				&Directive{Name: "events", Line: 3, Block: []Node{}},
+			},
+		},
+		{
+			name:          "test parse unterminated directive",
+			source:        "server {\n    listen 80\n}",
+			expectedError: "line 3: unexpected \"}\"",
+		},
+		{
+			name:          "test parse unclosed block",
+			source:        "server {\n    listen 80;\n",
+			expectedError: "unexpected end of file, expecting \"}\"",
+		},
+		{
+			name:          "test parse unterminated quote",
+			source:        "add_header X \"value;\n",
+			expectedError: "line 1: unterminated quoted string",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			nodes, err := parseConfig([]byte(testCase.source))
+			if testCase.expectedError != "" {
+				assert.EqualError(t, err, testCase.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedNodes, nodes)
+		})
+	}
+}
+
+func TestImportServerBlocks(t *testing.T) {
+	generated := []Service{
+		{Selection: 1, Domains: "sidsun.com cdn.sidsun.com", Root: "/srv/www/sid", Port: 443, Additional: Additions{AddHSTSConfig: true, AddSecurityConfig: true}},
+		{Selection: 2, Domains: "sulabs.org", Root: "/srv/www/su", Port: 443, Additional: Additions{AddCachingConfig: true, MaxCacheAge: "1d"}},
+		{Selection: 3, Domains: "encrypt.ml", Root: "/srv/www/encrypt", Port: 443},
+		{Selection: 4, Domains: "php.sidsun.com", Root: "/srv/www/php", Port: 443, Additional: Additions{AddSecurityConfig: true}},
+		{Selection: 4, Domains: "php.sidsun.com", Root: "/srv/www/php", PHPBackend: "unix:/run/php/php8.1-fpm.sock", Port: 8080},
+		{Selection: 5, Domains: "blog.sidsun.com", URL: "https://blog.sidsun.com", Port: 443, Additional: Additions{AddHSTSConfig: true}},
+		{Selection: 6, Domains: "sidsun.com", URL: "http://blog.sidsun.com$request_uri", Port: 443},
+		{Selection: 7, Domains: "api.sidsun.com", URL: "http://127.0.0.1:5000", Port: 4321},
+		{Selection: 8, Domains: "_", Port: 80, Additional: Additions{MakeDefaultServer: true}},
+		{Selection: 5, Domains: "tls.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true, LiveDir: "/opt/certbot/live"}}},
+		{Selection: 7, Domains: "tls.sidsun.com", URL: "http://127.0.0.1:8000", Port: 8443, Additional: Additions{TLS: TLSConfig{Certificate: "/etc/ssl/tls.sidsun.com/cert.pem", Key: "/etc/ssl/tls.sidsun.com/key.pem"}}},
+		{Selection: 1, Domains: "tls.sidsun.com", Root: "/srv/www/tls", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true, Profile: "intermediate"}}},
+		{Selection: 6, Domains: "tls.sidsun.com", URL: "https://sidsun.com", Port: 443, Additional: Additions{TLS: TLSConfig{Certificate: "/etc/ssl/cert.pem", Key: "/etc/ssl/key.pem", Profile: "old", Resolver: "1.1.1.1"}}},
+		{Selection: 5, Domains: "redirect.sidsun.com www.redirect.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{RedirectHTTP: true}},
+		{Selection: 1, Domains: "redirect.sidsun.com", Root: "/srv/www", Port: 443, Additional: Additions{RedirectHTTP: true, ChallengeWebroot: "/var/www/acme", TLS: TLSConfig{LetsEncrypt: true}}},
+		{Selection: 3, Domains: "canonical.sidsun.com www.canonical.sidsun.com", CanonicalHost: "canonical.sidsun.com", Root: "/srv/www", Port: 443, Additional: Additions{RedirectHTTP: true, ChallengeWebroot: "/var/www/acme"}},
+		{Selection: 7, Domains: "canonical.sidsun.com *.canonical.sidsun.com", CanonicalHost: "canonical.sidsun.com", URL: "http://127.0.0.1:8000", Port: 8080},
+		{Selection: 9, Domains: "lb.sidsun.com", Port: 443, Upstream: Upstream{Method: "hash", HashKey: "$request_uri consistent", Servers: []UpstreamServer{
+			{Address: "10.0.0.1:8000", Weight: 3, MaxFails: 2, FailTimeout: "10s"},
+			{Address: "unix:/run/app.sock"},
+		}}},
+		{Selection: 9, Domains: "lb.sidsun.com", Port: 8080, Upstream: Upstream{Servers: []UpstreamServer{{Address: "10.0.0.1:8000"}, {Address: "10.0.0.2:8000", Backup: true}}}},
+		{Selection: 5, Domains: "proxy.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Proxy: ProxyConfig{ForwardHeaders: true, ConnectTimeout: "5s", SendTimeout: "30s", ReadTimeout: "5m", DisableBuffering: true, MaxBodySize: "10m"}},
+		{Selection: 10, Domains: "grpc.sidsun.com", URL: "grpcs://10.0.0.1:50051", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}}},
+		{Selection: 10, Domains: "grpc.sidsun.com", URL: "grpc://127.0.0.1:50051", Port: 8080, Proxy: ProxyConfig{ConnectTimeout: "5s", ReadTimeout: "10m", SendTimeout: "10m", MaxBodySize: "16m"}},
+		{Selection: 3, Domains: "routes.sidsun.com", Root: "/srv/www/app", Port: 443, Locations: []Location{
+			{Match: "prefix", Path: "/api/", Selection: 5, URL: "http://127.0.0.1:8000", Proxy: ProxyConfig{ForwardHeaders: true, WebSocket: true}},
+			{Match: "prefix", Path: "/static/", Selection: 2, Root: "/srv/www/assets"},
+			{Match: "exact", Path: "/status", Selection: 6, URL: "https://status.sidsun.com"},
+			{Match: "regex", Path: `^/blog/.*\.php$`, Selection: 4, Root: "/srv/www/blog", PHPBackend: "127.0.0.1:9000"},
+			{Match: "prefix", Path: "/admin/", Selection: 3, Root: "/srv/www/admin"},
+			{Match: "prefix", Path: "/docs/", Selection: 1, Root: "/srv/www/docs"},
+		}},
+		{Selection: 5, Domains: "routes.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Locations: []Location{{Match: "prefix", Path: "/ws/", Selection: 5, URL: "http://127.0.0.1:9000", Proxy: ProxyConfig{WebSocket: true}}}},
+		{Selection: 5, Domains: "ws.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Proxy: ProxyConfig{WebSocket: true}},
+		{Selection: 12, Domains: "blog.sidsun.com", Root: "/srv/www/wordpress", Port: 443, Additional: Additions{AddSecurityConfig: true}},
+		{Selection: 12, Domains: "wp.sidsun.com", Root: "/srv/www/wp", PHPBackend: "127.0.0.1:9000", Port: 443, Locations: []Location{{Match: "prefix", Path: "/shop/", Selection: 5, URL: "http://127.0.0.1:8000"}}},
+		{Selection: 11, Domains: "django.sidsun.com", Port: 443, WSGI: WSGIConfig{Socket: "unix:/run/uwsgi/app.sock", Static: "/srv/app/static", Media: "/srv/app/media"}},
+		{Selection: 11, Domains: "flask.sidsun.com", Port: 8080, WSGI: WSGIConfig{Server: "gunicorn", Socket: "127.0.0.1:8000", Static: "/srv/flask/static"}},
+		{Selection: 9, Domains: "lb.sidsun.com", Port: 443, Proxy: ProxyConfig{ForwardHeaders: true, WebSocketPaths: []string{"/socket.io/", "/ws"}}, Upstream: Upstream{Keepalive: 32, Servers: []UpstreamServer{{Address: "10.0.0.1:8000"}}}},
+	}
+	for _, service := range generated {
+		t.Run("test import generated config for preset "+service.Domains, func(t *testing.T) {
+			_, contents := prepareServiceFileContents(service)
+			nodes, err := parseConfig([]byte(contents))
+			assert.NoError(t, err)
+			results := importServerBlocks(nodes)
+			assert.Len(t, results, 1)
+			assert.Empty(t, results[0].Problems)
+			assert.Empty(t, results[0].Warnings)
+			assert.Equal(t, service, results[0].Service)
+		})
+	}
+
+	t.Run("test import hand written config with warnings and problems", func(t *testing.T) {
+		nodes, err := parseConfig([]byte(`http {
+    server {
+        listen 8080 default_server;
+        server_name app.example.com;
+        access_log /var/log/nginx/app.log;
+        gzip on;
+        location / {
+            proxy_pass http://127.0.0.1:3000;
+        }
+    }
+    server {
+        listen 80;
+        server_name www.example.com;
+        return 301 https://example.com$request_uri;
+    }
+    server {
+        listen 80;
+        location / {
+            echo hello;
+        }
+    }
+    server {
+        listen 80 default_server;
+        server_name "";
+        return 308 https://$host$request_uri;
+    }
+}`))
+		assert.NoError(t, err)
+		results := importServerBlocks(nodes)
+		assert.Len(t, results, 4)
+
+		assert.Equal(t, Service{Selection: 7, Domains: "app.example.com", URL: "http://127.0.0.1:3000", Port: 8080, Additional: Additions{MakeDefaultServer: true}}, results[0].Service)
+		assert.Equal(t, []string{"line 6: directive gzip is not supported and will be dropped"}, results[0].Warnings)
+		assert.Empty(t, results[0].Problems)
+
+		assert.Equal(t, Service{Selection: 6, Domains: "www.example.com", URL: "https://example.com$request_uri", Port: 80}, results[1].Service)
+		assert.Equal(t, []string{"line 14: return 301 will be generated as a permanent (308) redirect"}, results[1].Warnings)
+
+		assert.Equal(t, 16, results[2].Line)
+		assert.Equal(t, []string{
+			"no server_name directive",
+			"no supported content handler (root, try_files, fastcgi_pass, proxy_pass, grpc_pass, uwsgi_pass or return) found",
+		}, results[2].Problems)
+
+		assert.Equal(t, []string{"line 24: no server_name to name the service after"}, results[3].Problems)
+	})
+}
+
+func TestImportFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nginx.conf")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`server {
+    listen 80;
+    server_name my_host.local;
+    root /srv/www;
+}
+server {
+    listen 8080;
+    server_name app.sidsun.com;
+    location / {
+        proxy_pass unix:/run/app.sock;
+    }
+}
+server {
+    listen 80;
+    server_name sidsun.com;
+    root /srv/www;
+}
+`), 0644))
+
+	out := filepath.Join(dir, "services")
+	assert.Equal(t, exitError, importFiles([]string{path}, out))
+	assert.False(t, fileExists(filepath.Join(out, "my_host.local.toml")))
+	assert.False(t, fileExists(filepath.Join(out, "app.sidsun.com.toml")))
+	assert.True(t, fileExists(filepath.Join(out, "sidsun.com.toml")))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultPHPSocket is the PHP-FPM the PHP preset passes to when PHPBackend isn't set, which files written before it
+// existed rely on
+const defaultPHPSocket = "unix:/var/run/php/php7.2-fpm.sock"
+
+// defaultPHPSocketGlob is where the wizard looks for PHP-FPM sockets, NGINX_AUTO_CONFIG_PHP_SOCKETS overrides it
+const defaultPHPSocketGlob = "/run/php/*.sock"
+
+// phpBackend returns the fastcgi_pass address for backend, the defaultPHPSocket when it is empty
+func phpBackend(backend string) string {
+	if backend == "" {
+		return defaultPHPSocket
+	}
+	return backend
+}
+
+// buildPHPLocation creates the regex location passing PHP files to the PHP-FPM at backend, modifier is ~ or ~*
+func buildPHPLocation(modifier string, backend string) *Directive {
+	return newBlock("location", modifier, `\.php$`).add(
+		newDirective("include", "snippets/fastcgi-php.conf"),
+		&Directive{Name: "fastcgi_pass", Args: []string{phpBackend(backend)}, Separator: "  "},
+	)
+}
+
+// isFastCGIAddress reports whether address is a unix:/path socket or a host:port fastcgi_pass accepts
+func isFastCGIAddress(address string) bool {
+	if strings.HasPrefix(address, "unix:/") {
+		return !strings.ContainsAny(address, " \t;")
+	}
+	host, port, err := net.SplitHostPort(address)
+	number, portErr := strconv.Atoi(port)
+	return err == nil && host != "" && portErr == nil && number > 0 && number < 65536
+}
+
+// importPHPBackend returns the PHPBackend for the fastcgi_pass of a PHP location, empty for the defaultPHPSocket
+func importPHPBackend(fastCGIPass *Directive) string {
+	if backend := unquote(strings.Join(fastCGIPass.Args, " ")); backend != defaultPHPSocket {
+		return backend
+	}
+	return ""
+}
+
+// findPHPSockets returns the PHP-FPM sockets matching NGINX_AUTO_CONFIG_PHP_SOCKETS or the defaultPHPSocketGlob
+func findPHPSockets() []string {
+	pattern := os.Getenv("NGINX_AUTO_CONFIG_PHP_SOCKETS")
+	if pattern == "" {
+		pattern = defaultPHPSocketGlob
+	}
+	matches, _ := filepath.Glob(pattern) // The only error is a malformed pattern, which matches nothing
+	var sockets []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode()&os.ModeSocket != 0 {
+			sockets = append(sockets, match)
+		}
+	}
+	return sockets
+}
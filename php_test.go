@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsPHPBackend(t *testing.T) {
+	service := Service{Selection: 4, Domains: "php.sidsun.com", Root: "/srv/www/php", PHPBackend: "127.0.0.1:9000", Port: 8080}
+	_, fileContents := prepareServiceFileContents(service)
+	assert.Contains(t, fileContents, "        fastcgi_pass  127.0.0.1:9000;\n")
+	assert.NotContains(t, fileContents, defaultPHPSocket)
+}
+
+func TestIsFastCGIAddress(t *testing.T) {
+	testCases := []struct {
+		address  string
+		expected bool
+	}{
+		{"unix:/run/php/php8.1-fpm.sock", true},
+		{"127.0.0.1:9000", true},
+		{"php.internal:9000", true},
+		{"[::1]:9000", true},
+		{"/run/php/php8.1-fpm.sock", false},
+		{"127.0.0.1", false},
+		{"127.0.0.1:70000", false},
+		{"http://127.0.0.1:9000", false},
+		{"unix:/run/php/php fpm.sock", false},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, isFastCGIAddress(testCase.address), testCase.address)
+	}
+}
+
+func TestPHPBackendValidate(t *testing.T) {
+	service := Service{Selection: 4, Domains: "php.sidsun.com", Root: "/srv/www/php", PHPBackend: "/run/php/php8.1-fpm.sock", Port: 443}
+	assert.Equal(t, ValidationErrors{{Field: "PHPBackend", Message: `"/run/php/php8.1-fpm.sock" is not a unix:/path socket or host:port`}}, service.Validate())
+
+	service = Service{Selection: 1, Domains: "sidsun.com", Root: "/srv/www", PHPBackend: "127.0.0.1:9000", Port: 443}
+	assert.Equal(t, ValidationErrors{{Field: "PHPBackend", Message: "is only used with presets 4 and 12"}}, service.Validate())
+}
+
+func TestFindPHPSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "php8.1-fpm.sock"))
+	assert.NoError(t, err)
+	defer listener.Close()
+	// Files which aren't sockets are skipped
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "php7.4-fpm.sock"), nil, 0644))
+
+	assert.NoError(t, os.Setenv("NGINX_AUTO_CONFIG_PHP_SOCKETS", filepath.Join(dir, "*.sock")))
+	defer os.Unsetenv("NGINX_AUTO_CONFIG_PHP_SOCKETS")
+	assert.Equal(t, []string{filepath.Join(dir, "php8.1-fpm.sock")}, findPHPSockets())
+}
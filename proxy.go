@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ProxyConfig tunes the locations of the proxy presets, zero values keep the nginx defaults
+type ProxyConfig struct {
+	ForwardHeaders   bool     // Send Host, X-Real-IP, X-Forwarded-For and X-Forwarded-Proto to the backend
+	ConnectTimeout   string   // proxy_connect_timeout
+	SendTimeout      string   // proxy_send_timeout
+	ReadTimeout      string   // proxy_read_timeout, 90 when empty
+	DisableBuffering bool     // Pass responses to the client as they arrive (proxy_buffering off)
+	MaxBodySize      string   // client_max_body_size of requests to the backend (ex: 10m)
+	WebSocket        bool     // Pass WebSocket upgrades through for all requests
+	WebSocketPaths   []string // Only pass WebSocket upgrades through for these paths (ex: /socket.io/)
+}
+
+const defaultProxyReadTimeout = "90"
+
+// Headers sent with ForwardHeaders, in the order they are generated
+var forwardedHeaders = [][]string{
+	{"Host", "$host"},
+	{"X-Real-IP", "$remote_addr"},
+	{"X-Forwarded-For", "$proxy_add_x_forwarded_for"},
+	{"X-Forwarded-Proto", "$scheme"},
+}
+
+// websocketSnippetName is the config defining $connection_upgrade for WebSocket proxies, it has to be included once at
+// the http level, which the configs in sites-enabled are
+const websocketSnippetName = "websocket-upgrade"
+
+// nginx sizes (ex: 512k, 10m, 1g), 0 disables the client_max_body_size check
+var nginxSize = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// configured reports whether any of the proxy settings is set
+func (config ProxyConfig) configured() bool {
+	return config.ForwardHeaders || config.ConnectTimeout != "" || config.SendTimeout != "" || config.ReadTimeout != "" ||
+		config.DisableBuffering || config.MaxBodySize != "" || config.WebSocket || len(config.WebSocketPaths) > 0
+}
+
+// validate reports problems with the proxy settings
+func (config ProxyConfig) validate() ValidationErrors {
+	var errs ValidationErrors
+	for _, timeout := range []struct{ field, value string }{
+		{"Proxy.ConnectTimeout", config.ConnectTimeout},
+		{"Proxy.SendTimeout", config.SendTimeout},
+		{"Proxy.ReadTimeout", config.ReadTimeout},
+	} {
+		if timeout.value != "" && !nginxTime.MatchString(timeout.value) {
+			errs = append(errs, FieldError{Field: timeout.field, Message: fmt.Sprintf("%q is not a valid nginx time (ex: 30s, 5m)", timeout.value)})
+		}
+	}
+	if config.MaxBodySize != "" && !nginxSize.MatchString(config.MaxBodySize) {
+		errs = append(errs, FieldError{Field: "Proxy.MaxBodySize", Message: fmt.Sprintf("%q is not a valid nginx size (ex: 512k, 10m, 1g)", config.MaxBodySize)})
+	}
+	seen := map[string]bool{}
+	for _, path := range config.WebSocketPaths {
+		switch {
+		case path == "/":
+			errs = append(errs, FieldError{Field: "Proxy.WebSocketPaths", Message: "use WebSocket for all requests instead of the path /"})
+		case !strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t;{}"):
+			errs = append(errs, FieldError{Field: "Proxy.WebSocketPaths", Message: fmt.Sprintf("%q is not a path (ex: /socket.io/)", path)})
+		case seen[path]:
+			errs = append(errs, FieldError{Field: "Proxy.WebSocketPaths", Message: fmt.Sprintf("%q is listed more than once", path)})
+		}
+		seen[path] = true
+	}
+	return errs
+}
+
+// usesWebSocket reports whether the service proxies WebSockets and needs the websocketSnippet
+func (server Service) usesWebSocket() bool {
+	if inRange(server.Selection, []int{5, 7, 9}) && (server.Proxy.WebSocket || len(server.Proxy.WebSocketPaths) > 0) {
+		return true
+	}
+	for _, location := range server.Locations {
+		if location.Selection == 5 && location.Proxy.WebSocket {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketSnippet maps the Upgrade header of the request to the Connection header sent to the backend
+func websocketSnippet() renderedConfig {
+	return renderedConfig{FileName: websocketSnippetName, Contents: printConfig(
+		newBlock("map", "$http_upgrade", "$connection_upgrade").add(
+			newDirective("default", "upgrade"),
+			newDirective("''", "close"),
+		),
+	)}
+}
+
+// buildProxyLocations creates the locations of the WebSocketPaths followed by location /
+func buildProxyLocations(target string, config ProxyConfig, keepalive bool) []Node {
+	var locations []Node
+	for _, path := range config.WebSocketPaths {
+		locations = append(locations, buildProxyLocation([]string{path}, target, config, keepalive, true))
+	}
+	return append(locations, buildProxyLocation([]string{"/"}, target, config, keepalive, config.WebSocket))
+}
+
+// buildProxyLocation creates the location with args proxying to target, keepalive connections to an upstream need HTTP/1.1
+// without the Connection: close nginx sends by default, WebSockets need HTTP/1.1 with the Upgrade passed through
+func buildProxyLocation(args []string, target string, config ProxyConfig, keepalive bool, websocket bool) *Directive {
+	readTimeout := config.ReadTimeout
+	if readTimeout == "" {
+		readTimeout = defaultProxyReadTimeout
+	}
+	location := newBlock("location", args...).add(
+		newDirective("proxy_pass", target),
+		&Directive{Name: "proxy_read_timeout", Args: []string{readTimeout}, Separator: "  "},
+	)
+	if config.ConnectTimeout != "" {
+		location.add(newDirective("proxy_connect_timeout", config.ConnectTimeout))
+	}
+	if config.SendTimeout != "" {
+		location.add(newDirective("proxy_send_timeout", config.SendTimeout))
+	}
+	switch {
+	case websocket:
+		location.add(
+			newDirective("proxy_http_version", "1.1"),
+			newDirective("proxy_set_header", "Upgrade", "$http_upgrade"),
+			newDirective("proxy_set_header", "Connection", "$connection_upgrade"),
+		)
+	case keepalive:
+		location.add(
+			newDirective("proxy_http_version", "1.1"),
+			newDirective("proxy_set_header", "Connection", `""`),
+		)
+	}
+	if config.ForwardHeaders {
+		for _, header := range forwardedHeaders {
+			location.add(newDirective("proxy_set_header", header...))
+		}
+	}
+	if config.DisableBuffering {
+		location.add(newDirective("proxy_buffering", "off"))
+	}
+	if config.MaxBodySize != "" {
+		location.add(newDirective("client_max_body_size", config.MaxBodySize))
+	}
+	return location
+}
+
+// importProxy reads the proxy settings of a location with proxy_pass, warning about what it can't represent
+func importProxy(location *Directive, warn func(format string, args ...interface{})) ProxyConfig {
+	var config ProxyConfig
+	headers := map[string]string{}
+	var upgrade, connectionUpgrade bool
+	for _, node := range location.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		args := unquoteArgs(directive.Args)
+		switch name := directive.Name; {
+		case name == "proxy_pass":
+		case name == "proxy_read_timeout" && len(args) == 1:
+			if args[0] != defaultProxyReadTimeout {
+				config.ReadTimeout = args[0]
+			}
+		case name == "proxy_connect_timeout" && len(args) == 1:
+			config.ConnectTimeout = args[0]
+		case name == "proxy_send_timeout" && len(args) == 1:
+			config.SendTimeout = args[0]
+		case name == "proxy_buffering" && len(args) == 1:
+			config.DisableBuffering = args[0] == "off"
+		case name == "client_max_body_size" && len(args) == 1:
+			config.MaxBodySize = args[0]
+		// Generated for keepalive connections to an upstream and for WebSockets
+		case name == "proxy_http_version" && len(args) == 1 && args[0] == "1.1":
+		case name == "proxy_set_header" && len(args) == 2 && args[0] == "Connection" && args[1] == "":
+		case name == "proxy_set_header" && len(args) == 2 && args[0] == "Upgrade" && args[1] == "$http_upgrade":
+			upgrade = true
+		case name == "proxy_set_header" && len(args) == 2 && args[0] == "Connection" && args[1] == "$connection_upgrade":
+			connectionUpgrade = true
+		case name == "proxy_set_header" && len(args) == 2:
+			headers[args[0]] = args[1]
+		default:
+			warn("line %d: directive %s in location %s is not supported and will be dropped", directive.Line, name, strings.Join(location.Args, " "))
+		}
+	}
+	config.WebSocket = upgrade && connectionUpgrade
+	if upgrade != connectionUpgrade {
+		warn("line %d: WebSockets need both the Upgrade and Connection headers, the header will be dropped", location.Line)
+	}
+	if len(headers) == 0 {
+		return config
+	}
+	config.ForwardHeaders = len(headers) == len(forwardedHeaders)
+	for _, header := range forwardedHeaders {
+		if headers[header[0]] != header[1] {
+			config.ForwardHeaders = false
+		}
+	}
+	if !config.ForwardHeaders {
+		warn("line %d: proxy_set_header is only generated for all of %s, the headers will be dropped", location.Line, forwardedHeaderNames())
+	}
+	return config
+}
+
+func forwardedHeaderNames() string {
+	names := make([]string, len(forwardedHeaders))
+	for i, header := range forwardedHeaders {
+		names[i] = header[0]
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildProxyLocations(t *testing.T) {
+	testCases := []struct {
+		name              string
+		config            ProxyConfig
+		keepalive         bool
+		expectedLocations string
+	}{
+		{
+			name: "test defaults",
+			expectedLocations: `location / {
+    proxy_pass http://127.0.0.1:8000;
+    proxy_read_timeout  90;
+}
+`,
+		},
+		{
+			name:      "test forwarded headers, timeouts, buffering and body size with keepalive",
+			config:    ProxyConfig{ForwardHeaders: true, ConnectTimeout: "5s", SendTimeout: "30s", ReadTimeout: "5m", DisableBuffering: true, MaxBodySize: "10m"},
+			keepalive: true,
+			expectedLocations: `location / {
+    proxy_pass http://127.0.0.1:8000;
+    proxy_read_timeout  5m;
+    proxy_connect_timeout 5s;
+    proxy_send_timeout 30s;
+    proxy_http_version 1.1;
+    proxy_set_header Connection "";
+    proxy_set_header Host $host;
+    proxy_set_header X-Real-IP $remote_addr;
+    proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+    proxy_set_header X-Forwarded-Proto $scheme;
+    proxy_buffering off;
+    client_max_body_size 10m;
+}
+`,
+		},
+		{
+			name:      "test WebSocket path with keepalive",
+			config:    ProxyConfig{WebSocketPaths: []string{"/socket.io/"}},
+			keepalive: true,
+			expectedLocations: `location /socket.io/ {
+    proxy_pass http://127.0.0.1:8000;
+    proxy_read_timeout  90;
+    proxy_http_version 1.1;
+    proxy_set_header Upgrade $http_upgrade;
+    proxy_set_header Connection $connection_upgrade;
+}
+
+location / {
+    proxy_pass http://127.0.0.1:8000;
+    proxy_read_timeout  90;
+    proxy_http_version 1.1;
+    proxy_set_header Connection "";
+}
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedLocations, printConfig(buildProxyLocations("http://127.0.0.1:8000", testCase.config, testCase.keepalive)...))
+		})
+	}
+}
+
+func TestProxyValidate(t *testing.T) {
+	service := Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Proxy: ProxyConfig{ReadTimeout: "5 minutes", MaxBodySize: "10MB"}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Proxy.ReadTimeout", Message: `"5 minutes" is not a valid nginx time (ex: 30s, 5m)`},
+		{Field: "Proxy.MaxBodySize", Message: `"10MB" is not a valid nginx size (ex: 512k, 10m, 1g)`},
+	}, service.Validate())
+
+	static := Service{Selection: 1, Domains: "sidsun.com", Root: "/srv/www", Port: 443, Proxy: ProxyConfig{ForwardHeaders: true}}
+	assert.Equal(t, ValidationErrors{{Field: "Proxy", Message: "is only used with presets 5, 7, 9 and 10"}}, static.Validate())
+}
+
+func TestImportProxyHeaders(t *testing.T) {
+	nodes, err := parseConfig([]byte(`server {
+    listen 80;
+    server_name app.example.com;
+    location / {
+        proxy_pass http://127.0.0.1:3000;
+        proxy_set_header Host $host;
+        proxy_redirect off;
+    }
+}`))
+	assert.NoError(t, err)
+	results := importServerBlocks(nodes)
+	assert.Len(t, results, 1)
+	assert.Equal(t, ProxyConfig{}, results[0].Service.Proxy)
+	assert.Equal(t, []string{
+		"line 7: directive proxy_redirect in location / is not supported and will be dropped",
+		"line 4: proxy_set_header is only generated for all of Host, X-Real-IP, X-Forwarded-For, X-Forwarded-Proto, the headers will be dropped",
+	}, results[0].Warnings)
+}
+
+func TestRenderWebSocketSnippet(t *testing.T) {
+	file := serviceFile{Path: "chat.toml", Multiple: true, Services: []Service{
+		{Selection: 5, Domains: "chat.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Proxy: ProxyConfig{WebSocketPaths: []string{"/ws"}}},
+		{Selection: 5, Domains: "api.sidsun.com", URL: "http://127.0.0.1:9000", Port: 443, Proxy: ProxyConfig{WebSocket: true}},
+	}}
+	for _, split := range []bool{false, true} {
+		configs, err := file.render(split)
+		assert.NoError(t, err)
+		assert.Equal(t, renderedConfig{FileName: "websocket-upgrade", Contents: `map $http_upgrade $connection_upgrade {
+    default upgrade;
+    '' close;
+}
+`}, configs[len(configs)-1])
+	}
+
+	file.Services[0].Proxy.WebSocketPaths = []string{"/", "ws", "/ws", "/ws"}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Proxy.WebSocketPaths", Message: "use WebSocket for all requests instead of the path /"},
+		{Field: "Proxy.WebSocketPaths", Message: `"ws" is not a path (ex: /socket.io/)`},
+		{Field: "Proxy.WebSocketPaths", Message: `"/ws" is listed more than once`},
+	}, file.Services[0].Validate())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pelletier/go-toml"
+)
+
+// schemaVersion is the version of the service TOML format written by this program
+// Files written before versioning have no SchemaVersion and are treated as version 1
+const schemaVersion int = 2
+
+// migrations upgrade a service table (a single service file, a [[service]] table or [defaults]) from the version
+// matching their key to the next one, add a step and bump schemaVersion when fields or preset numbers change
+var migrations = map[int]func(table *toml.Tree) error{
+	// Version 2 only introduced SchemaVersion itself
+	1: func(table *toml.Tree) error { return nil },
+}
+
+// fileSchemaVersion reads the SchemaVersion of a service file tree
+func fileSchemaVersion(tree *toml.Tree) (int, error) {
+	if !tree.Has("SchemaVersion") {
+		return 1, nil
+	}
+	fileVersion, ok := tree.Get("SchemaVersion").(int64)
+	if !ok || fileVersion < 1 {
+		return 0, fmt.Errorf("SchemaVersion must be a positive integer")
+	}
+	if int(fileVersion) > schemaVersion {
+		return 0, fmt.Errorf("SchemaVersion %d is newer than the supported version %d, please update nginx-auto-config", fileVersion, schemaVersion)
+	}
+	return int(fileVersion), nil
+}
+
+// migrateTree upgrades a service file tree to schemaVersion in place, returns the version it was at
+func migrateTree(tree *toml.Tree) (int, error) {
+	fileVersion, err := fileSchemaVersion(tree)
+	if err != nil {
+		return 0, err
+	}
+	var tables []*toml.Tree
+	if entries, ok := tree.Get("service").([]*toml.Tree); ok {
+		tables = append(tables, entries...)
+		if defaults, ok := tree.Get("defaults").(*toml.Tree); ok {
+			tables = append(tables, defaults)
+		}
+	} else {
+		tables = append(tables, tree)
+	}
+	for from := fileVersion; from < schemaVersion; from++ {
+		for _, table := range tables {
+			if err := migrations[from](table); err != nil {
+				return 0, fmt.Errorf("migrating from SchemaVersion %d: %s", from, err.Error())
+			}
+		}
+	}
+	tree.Set("SchemaVersion", int64(schemaVersion))
+	return fileVersion, nil
+}
+
+// marshalService creates the TOML of a single service file at the current schemaVersion
+func marshalService(server Service) ([]byte, error) {
+	server.SchemaVersion = schemaVersion
+	return toml.Marshal(server)
+}
+
+// migrateFile rewrites a service file at the current schemaVersion, keeping the original as path.bak
+// It returns the version the file was at, files already up to date are left untouched
+func migrateFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return 0, err
+	}
+	fileVersion, err := migrateTree(tree)
+	if err != nil || fileVersion == schemaVersion {
+		return fileVersion, err
+	}
+	migrated, err := tree.ToTomlString()
+	if err != nil {
+		return 0, err
+	}
+	if err := writeContentToFile(path+".bak", data); err != nil {
+		return 0, err
+	}
+	return fileVersion, writeContentToFile(path, []byte(migrated))
+}
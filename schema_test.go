@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	legacy := "Selection = 5\nDomains = \"a.com\"\nURL = \"http://127.0.0.1:8000\"\nPort = 443\n"
+	path := filepath.Join(dir, "a.toml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(legacy), 0644))
+
+	fileVersion, err := migrateFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fileVersion)
+	backup, _ := ioutil.ReadFile(path + ".bak")
+	assert.Equal(t, legacy, string(backup))
+
+	file, err := loadServiceFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, schemaVersion, file.SchemaVersion)
+	assert.Equal(t, Service{SchemaVersion: schemaVersion, Selection: 5, Domains: "a.com", URL: "http://127.0.0.1:8000", Proxy: ProxyConfig{ForwardHeaders: true}, Port: 443}, file.Services[0])
+
+	assert.NoError(t, os.Remove(path+".bak"))
+	fileVersion, err = migrateFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, schemaVersion, fileVersion)
+	assert.False(t, fileExists(path+".bak"))
+
+	newer := filepath.Join(dir, "newer.toml")
+	assert.NoError(t, ioutil.WriteFile(newer, []byte("SchemaVersion = 99\n"+legacy), 0644))
+	_, err = migrateFile(newer)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SchemaVersion 99 is newer than the supported version")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// serviceFile is the contents of a service TOML file
+// It either holds a single Service at the top level, or [[service]] tables which inherit the values of an optional [defaults] table
+type serviceFile struct {
+	Path          string
+	Services      []Service
+	Multiple      bool
+	SchemaVersion int // Version the file was written at, the services are always migrated to schemaVersion
+}
+
+// renderedConfig is a config ready to be written to FileName.conf
+type renderedConfig struct {
+	FileName string
+	Contents string
+}
+
+// loadServiceFile reads a service TOML file with one or more services
+func loadServiceFile(path string) (serviceFile, error) {
+	file := serviceFile{Path: path}
+	if !fileExists(path) {
+		return file, fmt.Errorf("file %s seems to be nonexistent", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return file, err
+	}
+	if file.SchemaVersion, err = migrateTree(tree); err != nil {
+		return file, err
+	}
+	if !tree.Has("service") {
+		server, err := decodeService(tree)
+		file.Services = []Service{server}
+		return file, err
+	}
+
+	file.Multiple = true
+	entries, ok := tree.Get("service").([]*toml.Tree)
+	if !ok {
+		return file, fmt.Errorf("service must be an array of tables ([[service]])")
+	}
+	defaults := map[string]interface{}{}
+	if tree.Has("defaults") {
+		defaultsTree, ok := tree.Get("defaults").(*toml.Tree)
+		if !ok {
+			return file, fmt.Errorf("defaults must be a table ([defaults])")
+		}
+		defaults = defaultsTree.ToMap()
+	}
+	for i, entry := range entries {
+		merged, err := toml.TreeFromMap(mergeTables(defaults, entry.ToMap()))
+		if err != nil {
+			return file, fmt.Errorf("service[%d]: %s", i, err.Error())
+		}
+		server, err := decodeService(merged)
+		if err != nil {
+			return file, fmt.Errorf("service[%d]: %s", i, err.Error())
+		}
+		file.Services = append(file.Services, server)
+	}
+	return file, nil
+}
+
+// decodeService reads the Service of a table, the proxy presets forward the headers unless ForwardHeaders is set
+func decodeService(table *toml.Tree) (Service, error) {
+	server := Service{}
+	if err := table.Unmarshal(&server); err != nil {
+		return server, err
+	}
+	if inRange(server.Selection, []int{5, 7, 9}) && !table.HasPath([]string{"Proxy", "ForwardHeaders"}) {
+		server.Proxy.ForwardHeaders = true
+	}
+	return server, nil
+}
+
+// mergeTables returns the values of base overridden by the ones in override, nested tables are merged key by key
+func mergeTables(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseTable, baseIsTable := merged[key].(map[string]interface{})
+		overrideTable, overrideIsTable := value.(map[string]interface{})
+		if baseIsTable && overrideIsTable {
+			merged[key] = mergeTables(baseTable, overrideTable)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// check validates every service in the file, field paths of [[service]] tables are prefixed with service[index].
+// With verifyFiles the certificate files of the services are checked as well
+func (file serviceFile) check(verifyFiles bool) error {
+	var errs ValidationErrors
+	for i, server := range file.Services {
+		err := server.Validate()
+		if err == nil && verifyFiles {
+			err = verifyTLSFiles(server)
+		}
+		if err != nil {
+			if file.Multiple {
+				errs = append(errs, err.(ValidationErrors).prefixed(fmt.Sprintf("service[%d].", i))...)
+			} else {
+				errs = append(errs, err.(ValidationErrors)...)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// render creates the configs of the file: one for a single service, for multiple services either one combined config
+// named after the TOML file or, with split, one per service
+// The websocketSnippet is added as another config when any service proxies WebSockets
+func (file serviceFile) render(split bool) ([]renderedConfig, error) {
+	var configs []renderedConfig
+	if !file.Multiple || split {
+		seen := map[string]int{}
+		for i, server := range file.Services {
+			fileName, fileContents := prepareServiceFileContents(server)
+			if previous, ok := seen[fileName]; ok {
+				return nil, fmt.Errorf("service[%d] and service[%d] would both be written to %s.conf", previous, i, fileName)
+			}
+			seen[fileName] = i
+			configs = append(configs, renderedConfig{FileName: fileName, Contents: fileContents})
+		}
+	} else {
+		var blocks []Node
+		for _, server := range file.Services {
+			_, serverBlocks := buildServerBlocks(server)
+			blocks = append(blocks, serverBlocks...)
+		}
+		fileName := strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+		configs = append(configs, renderedConfig{FileName: fileName, Contents: printConfig(blocks...)})
+	}
+	for _, server := range file.Services {
+		if server.usesWebSocket() {
+			return append(configs, websocketSnippet()), nil
+		}
+	}
+	return configs, nil
+}
+
+// usesPlaceholderSSL reports whether any service in the file has commented out SSL directives
+func (file serviceFile) usesPlaceholderSSL() bool {
+	for _, server := range file.Services {
+		if server.usesPlaceholderSSL() {
+			return true
+		}
+	}
+	return false
+}
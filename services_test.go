@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadServiceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.toml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+[defaults]
+Port = 443
+[defaults.Additional]
+AddHSTSConfig = true
+AddSecurityConfig = true
+
+[[service]]
+Selection = 5
+Domains = "app.com"
+URL = "http://127.0.0.1:8000"
+
+[[service]]
+Selection = 6
+Domains = "www.app.com"
+URL = "https://app.com$request_uri"
+[service.Additional]
+AddSecurityConfig = false
+
+[[service]]
+Selection = 8
+Domains = "_"
+Port = 80
+[service.Additional]
+AddHSTSConfig = false
+MakeDefaultServer = true
+`), 0644))
+
+	file, err := loadServiceFile(path)
+	assert.NoError(t, err)
+	assert.True(t, file.Multiple)
+	assert.Equal(t, []Service{
+		{Selection: 5, Domains: "app.com", URL: "http://127.0.0.1:8000", Proxy: ProxyConfig{ForwardHeaders: true}, Port: 443, Additional: Additions{AddHSTSConfig: true, AddSecurityConfig: true}},
+		{Selection: 6, Domains: "www.app.com", URL: "https://app.com$request_uri", Port: 443, Additional: Additions{AddHSTSConfig: true}},
+		{Selection: 8, Domains: "_", Port: 80, Additional: Additions{AddSecurityConfig: true, MakeDefaultServer: true}},
+	}, file.Services)
+	assert.NoError(t, file.check(true))
+
+	combined, err := file.render(false)
+	assert.NoError(t, err)
+	assert.Len(t, combined, 1)
+	assert.Equal(t, "app", combined[0].FileName)
+	_, first := prepareServiceFileContents(file.Services[0])
+	_, second := prepareServiceFileContents(file.Services[1])
+	_, third := prepareServiceFileContents(file.Services[2])
+	assert.Equal(t, first+"\n"+second+"\n"+third, combined[0].Contents)
+
+	split, err := file.render(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []renderedConfig{{"app.com", first}, {"www.app.com", second}, {"default", third}}, split)
+
+	file.Services[1].Domains = "app.com"
+	_, err = file.render(true)
+	assert.EqualError(t, err, "service[0] and service[1] would both be written to app.com.conf")
+	file.Services[2].URL = ""
+	file.Services[1].URL = ""
+	assert.Equal(t, ValidationErrors{{Field: "service[1].URL", Message: "is required for preset 6"}}, file.check(true))
+}
+
+func TestDecodeServiceForwardHeaders(t *testing.T) {
+	for source, expected := range map[string]bool{
+		"Selection = 5\nURL = \"http://127.0.0.1:8000\"\n": true,
+		"Selection = 9\n": true,
+		"Selection = 7\nURL = \"http://127.0.0.1:8000\"\n[Proxy]\nForwardHeaders = false\n": false,
+		"Selection = 10\nURL = \"grpc://127.0.0.1:50051\"\n":                                false,
+		"Selection = 1\nRoot = \"/srv/www\"\n":                                              false,
+	} {
+		tree, err := toml.LoadBytes([]byte(source))
+		assert.NoError(t, err)
+		server, err := decodeService(tree)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, server.Proxy.ForwardHeaders, source)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLetsEncryptDir string = "/etc/letsencrypt/live" // Where certbot keeps the current certificates
+const defaultResolver string = "127.0.0.1"                   // Resolver used to fetch OCSP responses, as in the Mozilla templates
+
+// tlsProfile is one of the Mozilla SSL Configuration Generator profiles
+type tlsProfile struct {
+	Name                string
+	Description         string
+	Protocols           []string
+	Ciphers             string // Empty for TLSv1.3 only profiles, whose ciphers can't be configured
+	PreferServerCiphers string
+}
+
+// Profiles from https://ssl-config.mozilla.org (guideline 5.7), from the most to the least strict
+var tlsProfiles = []tlsProfile{
+	{
+		Name:                "modern",
+		Description:         "TLSv1.3 only, for clients from 2019 onwards",
+		Protocols:           []string{"TLSv1.3"},
+		PreferServerCiphers: "off",
+	},
+	{
+		Name:                "intermediate",
+		Description:         "TLSv1.2 and TLSv1.3, recommended for almost all servers",
+		Protocols:           []string{"TLSv1.2", "TLSv1.3"},
+		Ciphers:             "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305",
+		PreferServerCiphers: "off",
+	},
+	{
+		Name:                "old",
+		Description:         "TLSv1 to TLSv1.3, only for very old clients",
+		Protocols:           []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"},
+		Ciphers:             "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES128-SHA:ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA:ECDHE-RSA-AES256-SHA:DHE-RSA-AES128-SHA256:DHE-RSA-AES256-SHA256:AES128-GCM-SHA256:AES256-GCM-SHA384:AES128-SHA256:AES256-SHA256:AES128-SHA:AES256-SHA:DES-CBC3-SHA",
+		PreferServerCiphers: "on",
+	},
+}
+
+func tlsProfileByName(name string) (tlsProfile, bool) {
+	for _, profile := range tlsProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return tlsProfile{}, false
+}
+
+// tlsProfileNameList returns the profile names separated by ", " for help and error messages
+func tlsProfileNameList() string {
+	names := make([]string, len(tlsProfiles))
+	for i, profile := range tlsProfiles {
+		names[i] = profile.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// TLSConfig points at the certificate of an HTTPS server
+// Without a Certificate or LetsEncrypt the SSL directives are emitted commented out for the user to fill in
+type TLSConfig struct {
+	Certificate string // Certificate with its intermediates (ssl_certificate)
+	Key         string // Private key of the certificate (ssl_certificate_key)
+	Chain       string // Intermediate and root certificates used to verify OCSP responses (ssl_trusted_certificate)
+	LetsEncrypt bool   // Use the certificate certbot keeps for the first domain in LiveDir
+	LiveDir     string // Defaults to /etc/letsencrypt/live
+	Profile     string // Mozilla profile (modern, intermediate or old), empty only sets ssl_protocols TLSv1.2 TLSv1.3
+	Resolver    string // Used for OCSP stapling with a Profile, defaults to 127.0.0.1
+}
+
+// configured reports whether a certificate was provided, so active SSL directives can be emitted
+func (config TLSConfig) configured() bool {
+	return config.LetsEncrypt || config.Certificate != ""
+}
+
+// paths returns the certificate, key and chain (empty when unset) for the server named fileName
+func (config TLSConfig) paths(fileName string) (string, string, string) {
+	if !config.LetsEncrypt {
+		return config.Certificate, config.Key, config.Chain
+	}
+	liveDir := config.LiveDir
+	if liveDir == "" {
+		liveDir = defaultLetsEncryptDir
+	}
+	dir := filepath.Join(liveDir, fileName)
+	return filepath.Join(dir, "fullchain.pem"), filepath.Join(dir, "privkey.pem"), filepath.Join(dir, "chain.pem")
+}
+
+// validate reports TLS fields which contradict each other
+func (config TLSConfig) validate() ValidationErrors {
+	var errs ValidationErrors
+	if config.LetsEncrypt && (config.Certificate != "" || config.Key != "" || config.Chain != "") {
+		errs = append(errs, FieldError{Field: "Additional.TLS.LetsEncrypt", Message: "can not be combined with Certificate, Key or Chain"})
+	}
+	if !config.LetsEncrypt && config.LiveDir != "" {
+		errs = append(errs, FieldError{Field: "Additional.TLS.LiveDir", Message: "is only used with LetsEncrypt"})
+	}
+	if config.Certificate != "" && config.Key == "" {
+		errs = append(errs, FieldError{Field: "Additional.TLS.Key", Message: "is required with Certificate"})
+	}
+	if config.Certificate == "" && (config.Key != "" || config.Chain != "") {
+		errs = append(errs, FieldError{Field: "Additional.TLS.Certificate", Message: "is required with Key and Chain"})
+	}
+	if _, ok := tlsProfileByName(config.Profile); config.Profile != "" && !ok {
+		errs = append(errs, FieldError{Field: "Additional.TLS.Profile", Message: fmt.Sprintf("%q is not a profile, must be one of %s", config.Profile, tlsProfileNameList())})
+	}
+	if config.Profile == "" && config.Resolver != "" {
+		errs = append(errs, FieldError{Field: "Additional.TLS.Resolver", Message: "is only used with Profile"})
+	}
+	return errs
+}
+
+// directives returns the SSL directives of the server named fileName, commented out with the certbot paths as
+// placeholders when no certificate is configured
+func (config TLSConfig) directives(fileName string) []Node {
+	certificate, key, chain := config.paths(fileName)
+	if !config.configured() {
+		certificate, key, chain = TLSConfig{LetsEncrypt: true}.paths(fileName)
+		chain = ""
+	}
+	protocols := []string{"TLSv1.2", "TLSv1.3"}
+	profile, hasProfile := tlsProfileByName(config.Profile)
+	if hasProfile {
+		protocols = profile.Protocols
+	}
+	directives := []*Directive{
+		newDirective("ssl_protocols", protocols...),
+		newDirective("ssl_certificate", certificate),
+		newDirective("ssl_certificate_key", key),
+	}
+	if chain != "" {
+		directives = append(directives, newDirective("ssl_trusted_certificate", chain))
+	}
+	if hasProfile {
+		if profile.Ciphers != "" {
+			directives = append(directives, newDirective("ssl_ciphers", profile.Ciphers))
+		}
+		resolver := config.Resolver
+		if resolver == "" {
+			resolver = defaultResolver
+		}
+		directives = append(directives,
+			newDirective("ssl_prefer_server_ciphers", profile.PreferServerCiphers),
+			newDirective("ssl_session_timeout", "1d"),
+			newDirective("ssl_session_cache", "shared:MozSSL:10m"),
+			newDirective("ssl_session_tickets", "off"),
+			newDirective("ssl_stapling", "on"),
+			newDirective("ssl_stapling_verify", "on"),
+			newDirective("resolver", strings.Fields(resolver)...),
+		)
+	}
+	nodes := make([]Node, len(directives))
+	for i, directive := range directives {
+		directive.Commented = !config.configured()
+		nodes[i] = directive
+	}
+	return nodes
+}
+
+// usesPlaceholderSSL reports whether the SSL directives of server are emitted commented out for the user to fill in
+func (server Service) usesPlaceholderSSL() bool {
+	return server.Port == 443 && !server.Additional.TLS.configured()
+}
+
+// verifyTLSFiles checks the certificate files of server exist and that the key belongs to the certificate
+func verifyTLSFiles(server Service) error {
+	config := server.Additional.TLS
+	if !config.configured() || len(config.validate()) > 0 {
+		return nil
+	}
+	domains := strings.Fields(server.Domains)
+	if len(domains) == 0 {
+		return nil
+	}
+	certificate, key, chain := config.paths(domains[0])
+	field := func(name string) string {
+		if config.LetsEncrypt {
+			return "Additional.TLS.LetsEncrypt"
+		}
+		return "Additional.TLS." + name
+	}
+	var errs ValidationErrors
+	for _, file := range []struct{ name, path string }{{"Certificate", certificate}, {"Key", key}, {"Chain", chain}} {
+		if file.path != "" && !fileExists(file.path) {
+			errs = append(errs, FieldError{Field: field(file.name), Message: fmt.Sprintf("%s does not exist", file.path)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if _, err := tls.LoadX509KeyPair(certificate, key); err != nil {
+		return ValidationErrors{{Field: field("Key"), Message: fmt.Sprintf("%s can not be used with %s: %s", key, certificate, err.Error())}}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrepareServiceFileContentsTLS(t *testing.T) {
+	testCases := []struct {
+		name     string
+		service  Service
+		expected string
+	}{
+		{
+			name:    "test proxy with Let's Encrypt certificate",
+			service: Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}}},
+			expected: `server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/sidsun.com/chain.pem;
+    location / {
+        proxy_pass http://127.0.0.1:8000;
+        proxy_read_timeout  90;
+    }
+}
+`,
+		},
+		{
+			name:    "test custom port with certificate files",
+			service: Service{Selection: 7, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 8443, Additional: Additions{TLS: TLSConfig{Certificate: "/etc/ssl/sidsun.pem", Key: "/etc/ssl/sidsun.key"}}},
+			expected: `server {
+    listen 8443 ssl http2;
+    listen [::]:8443 ssl http2;
+    server_name sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/ssl/sidsun.pem;
+    ssl_certificate_key /etc/ssl/sidsun.key;
+    location / {
+        proxy_pass http://127.0.0.1:8000;
+        proxy_read_timeout  90;
+    }
+}
+`,
+		},
+		{
+			name:    "test modern profile with resolver",
+			service: Service{Selection: 6, Domains: "sidsun.com", URL: "https://blog.sidsun.com", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true, Profile: "modern", Resolver: "1.1.1.1 8.8.8.8"}}},
+			expected: `server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/sidsun.com/chain.pem;
+    ssl_prefer_server_ciphers off;
+    ssl_session_timeout 1d;
+    ssl_session_cache shared:MozSSL:10m;
+    ssl_session_tickets off;
+    ssl_stapling on;
+    ssl_stapling_verify on;
+    resolver 1.1.1.1 8.8.8.8;
+    return 308 https://blog.sidsun.com;
+}
+`,
+		},
+		{
+			name:    "test HTTP redirect block serving the ACME challenge",
+			service: Service{Selection: 6, Domains: "sidsun.com www.sidsun.com", URL: "https://blog.sidsun.com", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}, RedirectHTTP: true, ChallengeWebroot: "/var/www/acme"}},
+			expected: `server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name sidsun.com www.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/sidsun.com/chain.pem;
+    return 308 https://blog.sidsun.com;
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name sidsun.com www.sidsun.com;
+    location ^~ /.well-known/acme-challenge/ {
+        root /var/www/acme;
+        default_type text/plain;
+    }
+    location / {
+        return 308 https://$host$request_uri;
+    }
+}
+`,
+		},
+		{
+			name:    "test canonical host with aliases redirected over HTTP and HTTPS",
+			service: Service{Selection: 5, Domains: "www.sidsun.com sidsun.com", CanonicalHost: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}, RedirectHTTP: true}},
+			expected: `server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/www.sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/www.sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/www.sidsun.com/chain.pem;
+    location / {
+        proxy_pass http://127.0.0.1:8000;
+        proxy_read_timeout  90;
+    }
+}
+
+server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name www.sidsun.com;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/www.sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/www.sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/www.sidsun.com/chain.pem;
+    return 308 https://sidsun.com$request_uri;
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name www.sidsun.com;
+    return 308 https://sidsun.com$request_uri;
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name sidsun.com;
+    return 308 https://$host$request_uri;
+}
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, contents := prepareServiceFileContents(testCase.service)
+			assert.Equal(t, testCase.expected, contents)
+			assert.False(t, testCase.service.usesPlaceholderSSL())
+		})
+	}
+}
+
+// writeCertificate writes a self-signed certificate for domain and its key to dir, returning their paths
+func writeCertificate(t *testing.T, dir string, domain string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certificatePath := filepath.Join(dir, domain+".pem")
+	keyPath := filepath.Join(dir, domain+".key")
+	assert.NoError(t, ioutil.WriteFile(certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certificatePath, keyPath
+}
+
+func TestVerifyTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx-auto-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certificate, key := writeCertificate(t, dir, "a.com")
+	_, otherKey := writeCertificate(t, dir, "b.com")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "live", "a.com"), 0755))
+
+	server := func(config TLSConfig) Service {
+		return Service{Selection: 1, Domains: "a.com www.a.com", Root: "/srv/www", Port: 443, Additional: Additions{TLS: config}}
+	}
+	testCases := []struct {
+		name           string
+		service        Service
+		expectedErrors ValidationErrors
+	}{
+		{
+			name:    "test matching certificate and key",
+			service: server(TLSConfig{Certificate: certificate, Key: key}),
+		},
+		{
+			name:    "test placeholder SSL is not checked",
+			service: server(TLSConfig{}),
+		},
+		{
+			name:    "test missing files",
+			service: server(TLSConfig{Certificate: filepath.Join(dir, "missing.pem"), Key: key, Chain: filepath.Join(dir, "chain.pem")}),
+			expectedErrors: ValidationErrors{
+				{Field: "Additional.TLS.Certificate", Message: filepath.Join(dir, "missing.pem") + " does not exist"},
+				{Field: "Additional.TLS.Chain", Message: filepath.Join(dir, "chain.pem") + " does not exist"},
+			},
+		},
+		{
+			name:    "test Let's Encrypt files of the first domain",
+			service: server(TLSConfig{LetsEncrypt: true, LiveDir: filepath.Join(dir, "live")}),
+			expectedErrors: ValidationErrors{
+				{Field: "Additional.TLS.LetsEncrypt", Message: filepath.Join(dir, "live", "a.com", "fullchain.pem") + " does not exist"},
+				{Field: "Additional.TLS.LetsEncrypt", Message: filepath.Join(dir, "live", "a.com", "privkey.pem") + " does not exist"},
+				{Field: "Additional.TLS.LetsEncrypt", Message: filepath.Join(dir, "live", "a.com", "chain.pem") + " does not exist"},
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := verifyTLSFiles(testCase.service)
+			if testCase.expectedErrors == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, testCase.expectedErrors, err)
+			}
+		})
+	}
+
+	t.Run("test key of another certificate", func(t *testing.T) {
+		err := verifyTLSFiles(server(TLSConfig{Certificate: certificate, Key: otherKey}))
+		assert.Error(t, err)
+		assert.Equal(t, "Additional.TLS.Key", err.(ValidationErrors)[0].Field)
+		assert.Contains(t, err.Error(), "can not be used with "+certificate)
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Upstream is the group of backend servers the load-balance preset proxies to
+type Upstream struct {
+	Method  string // round-robin (default), least_conn, ip_hash or hash
+	HashKey string // Key the hash method balances on (ex: $request_uri or $request_uri consistent)
+	Servers []UpstreamServer
+	// Idle connections to the servers each worker keeps open, the proxy then uses HTTP/1.1 to reuse them
+	Keepalive int
+}
+
+// UpstreamServer is a backend server of an Upstream, zero values keep the nginx defaults
+type UpstreamServer struct {
+	Address     string // host:port or unix:/path/to/socket
+	Weight      int
+	MaxFails    int
+	FailTimeout string
+	Backup      bool // Only used when all other servers are unavailable
+}
+
+var upstreamMethods = []string{"round-robin", "least_conn", "ip_hash", "hash"}
+
+var upstreamNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// upstreamName is the name of the upstream block of the service whose files are named fileName
+func upstreamName(fileName string) string {
+	return upstreamNameInvalid.ReplaceAllString(fileName, "_")
+}
+
+// backendFlags collects the repeatable --backend flag
+type backendFlags []UpstreamServer
+
+func (backends *backendFlags) String() string {
+	servers := make([]string, len(*backends))
+	for i, server := range *backends {
+		servers[i] = strings.Join(server.args(), " ")
+	}
+	return strings.Join(servers, ", ")
+}
+
+func (backends *backendFlags) Set(value string) error {
+	server, err := parseUpstreamServer(strings.Fields(value))
+	if err != nil {
+		return err
+	}
+	*backends = append(*backends, server)
+	return nil
+}
+
+// args returns the parameters of the server directive for the server
+func (server UpstreamServer) args() []string {
+	args := []string{server.Address}
+	if server.Weight != 0 {
+		args = append(args, "weight="+strconv.Itoa(server.Weight))
+	}
+	if server.MaxFails != 0 {
+		args = append(args, "max_fails="+strconv.Itoa(server.MaxFails))
+	}
+	if server.FailTimeout != "" {
+		args = append(args, "fail_timeout="+server.FailTimeout)
+	}
+	if server.Backup {
+		args = append(args, "backup")
+	}
+	return args
+}
+
+// parseUpstreamServer reads a backend server in the form of the parameters of the nginx server directive
+// (ex: 127.0.0.1:8000 weight=2 max_fails=3 fail_timeout=30s backup)
+func parseUpstreamServer(args []string) (UpstreamServer, error) {
+	var server UpstreamServer
+	if len(args) == 0 {
+		return server, fmt.Errorf("backend server has no address")
+	}
+	server.Address = args[0]
+	for _, arg := range args[1:] {
+		name, value := arg, ""
+		if i := strings.Index(arg, "="); i >= 0 {
+			name, value = arg[:i], arg[i+1:]
+		}
+		var err error
+		switch name {
+		case "weight":
+			server.Weight, err = strconv.Atoi(value)
+		case "max_fails":
+			server.MaxFails, err = strconv.Atoi(value)
+		case "fail_timeout":
+			server.FailTimeout = value
+		case "backup":
+			server.Backup = value == ""
+			if value != "" {
+				err = fmt.Errorf("backup takes no value")
+			}
+		default:
+			err = fmt.Errorf("unsupported parameter")
+		}
+		if err != nil {
+			return server, fmt.Errorf("%s of %s: %s", arg, server.Address, err.Error())
+		}
+	}
+	return server, nil
+}
+
+// validate reports problems with the upstream of the load-balance preset
+func (upstream Upstream) validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if upstream.Method != "" && !inStrings(upstream.Method, upstreamMethods) {
+		add("Upstream.Method", "%q is not a balancing method, must be one of %s", upstream.Method, strings.Join(upstreamMethods, ", "))
+	}
+	if upstream.Method == "hash" && upstream.HashKey == "" {
+		add("Upstream.HashKey", "is required for the hash method")
+	} else if upstream.Method != "hash" && upstream.HashKey != "" {
+		add("Upstream.HashKey", "is only used with the hash method")
+	}
+	if upstream.Keepalive < 0 {
+		add("Upstream.Keepalive", "%d can't be negative", upstream.Keepalive)
+	}
+	if len(upstream.Servers) == 0 {
+		add("Upstream.Servers", "at least one backend server is required")
+	}
+	for _, server := range upstream.Servers {
+		// Servers are reported by address, which --backend and the wizard take them by
+		if server.Address == "" || strings.Contains(server.Address, "://") || strings.ContainsAny(server.Address, " ;") {
+			add("Upstream.Servers", "%q is not a host:port or unix:/path address", server.Address)
+		}
+		if server.Weight < 0 || server.MaxFails < 0 {
+			add("Upstream.Servers", "%s: weight and max_fails can't be negative", server.Address)
+		}
+		if server.FailTimeout != "" && !nginxTime.MatchString(server.FailTimeout) {
+			add("Upstream.Servers", "%s: fail_timeout %q is not a valid nginx time (ex: 10s, 1m)", server.Address, server.FailTimeout)
+		}
+		if server.Backup && (upstream.Method == "ip_hash" || upstream.Method == "hash") {
+			add("Upstream.Servers", "%s: backup can't be used with the %s method", server.Address, upstream.Method)
+		}
+	}
+	return errs
+}
+
+// buildUpstreamBlock creates the upstream block named name with the backend servers
+func buildUpstreamBlock(name string, upstream Upstream) *Directive {
+	block := newBlock("upstream", name)
+	switch upstream.Method {
+	case "least_conn", "ip_hash":
+		block.add(newDirective(upstream.Method))
+	case "hash":
+		block.add(newDirective("hash", strings.Fields(upstream.HashKey)...))
+	}
+	for _, server := range upstream.Servers {
+		block.add(newDirective("server", server.args()...))
+	}
+	if upstream.Keepalive > 0 {
+		block.add(newDirective("keepalive", strconv.Itoa(upstream.Keepalive)))
+	}
+	return block
+}
+
+// importUpstream maps an upstream block onto an Upstream, warning about what it can't represent
+func importUpstream(block *Directive, warn func(format string, args ...interface{})) (Upstream, error) {
+	var upstream Upstream
+	for _, node := range block.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		switch name := directive.Name; {
+		case (name == "least_conn" || name == "ip_hash") && len(directive.Args) == 0:
+			upstream.Method = name
+		case name == "hash" && len(directive.Args) > 0:
+			upstream.Method = "hash"
+			upstream.HashKey = strings.Join(directive.Args, " ") // The key may be followed by consistent
+		case name == "server":
+			server, err := parseUpstreamServer(directive.Args)
+			if err != nil {
+				return upstream, fmt.Errorf("line %d: %s", directive.Line, err.Error())
+			}
+			upstream.Servers = append(upstream.Servers, server)
+		case name == "keepalive" && len(directive.Args) == 1:
+			keepalive, err := strconv.Atoi(directive.Args[0])
+			if err != nil {
+				return upstream, fmt.Errorf("line %d: keepalive %s is not a number", directive.Line, directive.Args[0])
+			}
+			upstream.Keepalive = keepalive
+		default:
+			warn("line %d: directive %s in upstream %s is not supported and will be dropped", directive.Line, name, strings.Join(block.Args, " "))
+		}
+	}
+	return upstream, nil
+}
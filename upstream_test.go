@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsUpstream(t *testing.T) {
+	service := Service{Selection: 9, Domains: "api.sidsun.com", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true}}, Upstream: Upstream{
+		Method: "least_conn",
+		Servers: []UpstreamServer{
+			{Address: "10.0.0.1:8000", Weight: 3},
+			{Address: "10.0.0.2:8000", MaxFails: 2, FailTimeout: "30s"},
+			{Address: "10.0.0.3:8000", Backup: true},
+		},
+	}}
+	fileName, fileContents := prepareServiceFileContents(service)
+	assert.Equal(t, "api.sidsun.com", fileName)
+	assert.Equal(t, `upstream api_sidsun_com {
+    least_conn;
+    server 10.0.0.1:8000 weight=3;
+    server 10.0.0.2:8000 max_fails=2 fail_timeout=30s;
+    server 10.0.0.3:8000 backup;
+}
+
+server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name api.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_certificate /etc/letsencrypt/live/api.sidsun.com/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/api.sidsun.com/privkey.pem;
+    ssl_trusted_certificate /etc/letsencrypt/live/api.sidsun.com/chain.pem;
+    location / {
+        proxy_pass http://api_sidsun_com;
+        proxy_read_timeout  90;
+    }
+}
+`, fileContents)
+}
+
+func TestParseUpstreamServer(t *testing.T) {
+	server, err := parseUpstreamServer([]string{"10.0.0.1:8000", "weight=2", "max_fails=3", "fail_timeout=1m", "backup"})
+	assert.NoError(t, err)
+	assert.Equal(t, UpstreamServer{Address: "10.0.0.1:8000", Weight: 2, MaxFails: 3, FailTimeout: "1m", Backup: true}, server)
+
+	_, err = parseUpstreamServer([]string{"10.0.0.1:8000", "weight=heavy"})
+	assert.Error(t, err)
+	_, err = parseUpstreamServer([]string{"10.0.0.1:8000", "slow_start=30s"})
+	assert.EqualError(t, err, "slow_start=30s of 10.0.0.1:8000: unsupported parameter")
+}
+
+func TestUpstreamValidate(t *testing.T) {
+	service := Service{Selection: 9, Domains: "api.sidsun.com", Port: 443}
+	assert.Equal(t, ValidationErrors{{Field: "Upstream.Servers", Message: "at least one backend server is required"}}, service.Validate())
+
+	service.Upstream = Upstream{Method: "hash", Servers: []UpstreamServer{
+		{Address: "http://10.0.0.1:8000"},
+		{Address: "10.0.0.2:8000", Weight: -1, FailTimeout: "soon", Backup: true},
+	}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Upstream.HashKey", Message: "is required for the hash method"},
+		{Field: "Upstream.Servers", Message: `"http://10.0.0.1:8000" is not a host:port or unix:/path address`},
+		{Field: "Upstream.Servers", Message: "10.0.0.2:8000: weight and max_fails can't be negative"},
+		{Field: "Upstream.Servers", Message: `10.0.0.2:8000: fail_timeout "soon" is not a valid nginx time (ex: 10s, 1m)`},
+		{Field: "Upstream.Servers", Message: "10.0.0.2:8000: backup can't be used with the hash method"},
+	}, service.Validate())
+
+	proxy := Service{Selection: 5, Domains: "api.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Upstream: Upstream{Method: "ip_hash"}}
+	assert.Equal(t, ValidationErrors{{Field: "Upstream", Message: "is only used with preset 9"}}, proxy.Validate())
+}
+
+func TestImportUpstream(t *testing.T) {
+	nodes, err := parseConfig([]byte(`upstream backend {
+    ip_hash;
+    server 10.0.0.1:8000 weight=2;
+    server 10.0.0.2:8000;
+    keepalive 16;
+    zone backend 64k;
+}
+
+server {
+    listen 80;
+    server_name app.example.com;
+    location / {
+        proxy_pass http://backend;
+    }
+}`))
+	assert.NoError(t, err)
+	results := importServerBlocks(nodes)
+	assert.Len(t, results, 1)
+	assert.Equal(t, Service{Selection: 9, Domains: "app.example.com", Port: 80, Upstream: Upstream{Method: "ip_hash", Servers: []UpstreamServer{
+		{Address: "10.0.0.1:8000", Weight: 2},
+		{Address: "10.0.0.2:8000"},
+	}, Keepalive: 16}}, results[0].Service)
+	assert.Equal(t, []string{
+		"line 6: directive zone in upstream backend is not supported and will be dropped",
+		"line 1: upstream backend will be generated as upstream app_example_com",
+	}, results[0].Warnings)
+}
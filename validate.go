@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FieldError is a problem with the value of a single field, Field is its path (ex: Additional.MaxCacheAge)
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors is every problem found while validating, in field order
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// prefixed returns the errors with prefix prepended to every field path
+func (errs ValidationErrors) prefixed(prefix string) ValidationErrors {
+	result := make(ValidationErrors, len(errs))
+	for i, err := range errs {
+		result[i] = FieldError{Field: prefix + err.Field, Message: err.Message}
+	}
+	return result
+}
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// nginx time values (ex: 30s, 1h30m, 2d) and the keywords expires accepts
+var nginxTime = regexp.MustCompile(`^(modified )?(-?([0-9]+(ms|s|m|h|d|w|M|y)?)+|epoch|max|off)$`)
+
+// Validate returns every problem with the service as ValidationErrors, or nil when it can be rendered
+func (server Service) Validate() error {
+	var errs ValidationErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if _, ok := presetBySelection(server.Selection); !ok {
+		add("Selection", "%d is not a preset, must be one of %d-%d", server.Selection, presets[0].Selection, presets[len(presets)-1].Selection)
+	}
+
+	if len(strings.Fields(server.Domains)) == 0 {
+		add("Domains", "is required")
+	}
+	for _, domain := range strings.Fields(server.Domains) {
+		if !isValidServerName(domain) {
+			add("Domains", "%q is not a valid hostname", domain)
+		}
+	}
+
+	if server.CanonicalHost != "" {
+		if !inStrings(server.CanonicalHost, strings.Fields(server.Domains)) {
+			add("CanonicalHost", "%q is not one of Domains", server.CanonicalHost)
+		} else if server.CanonicalHost == "_" || strings.ContainsAny(server.CanonicalHost, "*~") || strings.HasPrefix(server.CanonicalHost, ".") {
+			add("CanonicalHost", "%q can't be redirected to, it must be a hostname", server.CanonicalHost)
+		}
+	}
+
+	if inRange(server.Selection, []int{1, 2, 3, 4, 12}) && server.Root == "" {
+		add("Root", "is required for preset %d", server.Selection)
+	}
+
+	if server.PHPBackend != "" && !inRange(server.Selection, []int{4, 12}) {
+		add("PHPBackend", "is only used with presets 4 and 12")
+	} else if server.PHPBackend != "" && !isFastCGIAddress(server.PHPBackend) {
+		add("PHPBackend", "%q is not a unix:/path socket or host:port", server.PHPBackend)
+	}
+
+	if server.Selection == 10 {
+		if server.URL == "" {
+			add("URL", "is required for preset %d", server.Selection)
+		} else if !isGRPCAddress(server.URL) {
+			add("URL", "%q is not a grpc:// or grpcs:// address", server.URL)
+		}
+	}
+
+	if inRange(server.Selection, []int{5, 6, 7}) {
+		if server.URL == "" {
+			add("URL", "is required for preset %d", server.Selection)
+		} else if parsed, err := url.Parse(server.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add("URL", "%q is not an http(s) URL", server.URL)
+		}
+	}
+
+	if server.Selection == 11 {
+		errs = append(errs, validateWSGI(server.WSGI)...)
+	} else if server.WSGI != (WSGIConfig{}) {
+		add("WSGI", "is only used with preset 11")
+	}
+
+	if server.Selection == 9 {
+		errs = append(errs, server.Upstream.validate()...)
+	} else if server.Upstream.Method != "" || server.Upstream.HashKey != "" || len(server.Upstream.Servers) > 0 {
+		add("Upstream", "is only used with preset 9")
+	}
+
+	if server.Selection == 10 {
+		errs = append(errs, validateGRPC(server.Proxy)...)
+	} else if inRange(server.Selection, []int{5, 7, 9}) {
+		errs = append(errs, server.Proxy.validate()...)
+	} else if server.Proxy.configured() {
+		add("Proxy", "is only used with presets 5, 7, 9 and 10")
+	}
+
+	errs = append(errs, validateLocations(server)...)
+	errs = append(errs, validateAuth(server)...)
+
+	if server.Port == 0 {
+		add("Port", "is required")
+	} else if server.Port < 1 || server.Port > 65535 {
+		add("Port", "%d is not between 1 and 65535", server.Port)
+	}
+
+	if server.Additional.AddCachingConfig && server.Selection == 11 {
+		add("Additional.AddCachingConfig", "can't be used with preset 11, its regex would take the requests of /static/, /media/ and the app")
+	}
+	if server.Additional.AddCachingConfig && server.Selection == 12 {
+		add("Additional.AddCachingConfig", "is not used with preset 12, which caches its static assets itself")
+	}
+	if server.Additional.AddCachingConfig && server.Additional.MaxCacheAge != "" && !nginxTime.MatchString(server.Additional.MaxCacheAge) {
+		add("Additional.MaxCacheAge", "%q is not a valid nginx time (ex: 1m, 4h, 2d, 1y)", server.Additional.MaxCacheAge)
+	}
+
+	if server.Additional.RedirectHTTP && server.Port != 443 {
+		add("Additional.RedirectHTTP", "is only available for services on port 443")
+	}
+	if server.Additional.ChallengeWebroot != "" && !server.Additional.RedirectHTTP {
+		add("Additional.ChallengeWebroot", "is only used with RedirectHTTP")
+	}
+
+	errs = append(errs, server.Additional.TLS.validate()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isValidServerName reports whether name can be used in server_name: a hostname, optionally with a leading *. or
+// trailing .* wildcard, the catch-all _ or a ~regex
+func isValidServerName(name string) bool {
+	if name == "_" || strings.HasPrefix(name, "~") {
+		return true
+	}
+	name = strings.TrimPrefix(name, "*.")
+	name = strings.TrimSuffix(name, ".*")
+	name = strings.TrimPrefix(name, ".") // .example.com matches example.com and all its subdomains
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if !hostnameLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
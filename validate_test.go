@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestServiceValidate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		service        Service
+		expectedErrors ValidationErrors
+	}{
+		{
+			name:    "test valid static site with wildcard domain and cache age",
+			service: Service{Selection: 1, Domains: "sidsun.com *.sidsun.com", Root: "/srv/www", Port: 443, Additional: Additions{AddCachingConfig: true, MaxCacheAge: "1h30m"}},
+		},
+		{
+			name:    "test valid redirect with nginx variables",
+			service: Service{Selection: 6, Domains: "www.sidsun.com", URL: "https://sidsun.com$request_uri", Port: 443},
+		},
+		{
+			name:    "test valid default server",
+			service: Service{Selection: 8, Domains: "_", Port: 80, Additional: Additions{MakeDefaultServer: true}},
+		},
+		{
+			name:    "test empty service",
+			service: Service{},
+			expectedErrors: ValidationErrors{
+				{Field: "Selection", Message: "0 is not a preset, must be one of 1-12"},
+				{Field: "Domains", Message: "is required"},
+				{Field: "Port", Message: "is required"},
+			},
+		},
+		{
+			name:    "test invalid values",
+			service: Service{Selection: 5, Domains: "sidsun.com -bad.com under_score.com", URL: "127.0.0.1:8000", Port: 70000, Additional: Additions{AddCachingConfig: true, MaxCacheAge: "6 hours"}},
+			expectedErrors: ValidationErrors{
+				{Field: "Domains", Message: `"-bad.com" is not a valid hostname`},
+				{Field: "Domains", Message: `"under_score.com" is not a valid hostname`},
+				{Field: "URL", Message: `"127.0.0.1:8000" is not an http(s) URL`},
+				{Field: "Port", Message: "70000 is not between 1 and 65535"},
+				{Field: "Additional.MaxCacheAge", Message: `"6 hours" is not a valid nginx time (ex: 1m, 4h, 2d, 1y)`},
+			},
+		},
+		{
+			name:           "test missing root",
+			service:        Service{Selection: 4, Domains: "php.sidsun.com", Port: 443},
+			expectedErrors: ValidationErrors{{Field: "Root", Message: "is required for preset 4"}},
+		},
+		{
+			name:    "test conflicting TLS fields",
+			service: Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true, Key: "/etc/ssl/sidsun.key"}}},
+			expectedErrors: ValidationErrors{
+				{Field: "Additional.TLS.LetsEncrypt", Message: "can not be combined with Certificate, Key or Chain"},
+				{Field: "Additional.TLS.Certificate", Message: "is required with Key and Chain"},
+			},
+		},
+		{
+			name:    "test HTTP redirect of a service on another port",
+			service: Service{Selection: 7, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 8443, Additional: Additions{ChallengeWebroot: "/var/www/acme"}},
+			expectedErrors: ValidationErrors{
+				{Field: "Additional.ChallengeWebroot", Message: "is only used with RedirectHTTP"},
+			},
+		},
+		{
+			name:    "test canonical host which is not a domain",
+			service: Service{Selection: 5, Domains: "*.sidsun.com sidsun.com", CanonicalHost: "www.sidsun.com", URL: "http://127.0.0.1:8000", Port: 443},
+			expectedErrors: ValidationErrors{
+				{Field: "CanonicalHost", Message: `"www.sidsun.com" is not one of Domains`},
+			},
+		},
+		{
+			name:    "test unknown TLS profile",
+			service: Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, Additional: Additions{TLS: TLSConfig{LetsEncrypt: true, Profile: "strict"}}},
+			expectedErrors: ValidationErrors{
+				{Field: "Additional.TLS.Profile", Message: `"strict" is not a profile, must be one of modern, intermediate, old`},
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.service.Validate()
+			if testCase.expectedErrors == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, testCase.expectedErrors, err)
+		})
+	}
+}
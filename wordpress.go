@@ -0,0 +1,52 @@
+package main
+
+import "strings"
+
+// Static assets of WordPress sites, themes and plugins version their URLs so they can be cached for good
+const wordpressAssets = `\.(css|js|gif|ico|jpeg|jpg|png|svg|webp|woff|woff2|ttf|eot)$`
+
+// wordpressDenied are the locations of the WordPress preset answering 403 for files that shouldn't be reachable:
+// the XML-RPC endpoint brute force attacks go for, the config with the database credentials, dotfiles (.git, .htaccess)
+// except .well-known and PHP uploaded to wp-content/uploads
+var wordpressDenied = [][]string{
+	{"=", "/xmlrpc.php"},
+	{"~*", `/wp-config\.php`},
+	{"~", `/\.(?!well-known/)`},
+	{"~*", `^/wp-content/uploads/.*\.php$`},
+}
+
+// buildWordPressLocations creates the locations of the WordPress preset, the denied ones come before the PHP location
+// as regexes are matched in order
+func buildWordPressLocations(backend string) []Node {
+	locations := []Node{newBlock("location", "/").add(
+		// Pretty permalinks are routed by index.php
+		newDirective("try_files", "$uri", "$uri/", "/index.php?$args"),
+	)}
+	for _, denied := range wordpressDenied {
+		locations = append(locations, newBlock("location", denied...).add(newDirective("deny", "all")))
+	}
+	return append(locations,
+		buildPHPLocation("~", backend),
+		newBlock("location", "~*", wordpressAssets).add(
+			newDirective("expires", "max"),
+			newDirective("add_header", "Cache-Control", `"public, no-transform"`),
+			newDirective("log_not_found", "off"),
+		),
+	)
+}
+
+// isWordPressTryFiles reports whether try_files routes the requests to index.php like the WordPress preset does
+func isWordPressTryFiles(tryFiles *Directive) bool {
+	return tryFiles != nil && strings.Join(tryFiles.Args, " ") == "$uri $uri/ /index.php?$args"
+}
+
+// isWordPressLocation reports whether location is one of the denied or asset locations the WordPress preset generates
+func isWordPressLocation(location *Directive) bool {
+	args := strings.Join(location.Args, " ")
+	for _, denied := range wordpressDenied {
+		if args == strings.Join(denied, " ") {
+			return true
+		}
+	}
+	return args == "~* "+wordpressAssets
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsWordPress(t *testing.T) {
+	service := Service{Selection: 12, Domains: "blog.sidsun.com", Root: "/srv/www/wordpress", PHPBackend: "unix:/run/php/php8.1-fpm.sock", Port: 8080}
+	fileName, fileContents := prepareServiceFileContents(service)
+	assert.Equal(t, "blog.sidsun.com", fileName)
+	assert.Equal(t, `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name blog.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+    root /srv/www/wordpress;
+    index index.php;
+    location / {
+        try_files $uri $uri/ /index.php?$args;
+    }
+    location = /xmlrpc.php {
+        deny all;
+    }
+    location ~* /wp-config\.php {
+        deny all;
+    }
+    location ~ /\.(?!well-known/) {
+        deny all;
+    }
+    location ~* ^/wp-content/uploads/.*\.php$ {
+        deny all;
+    }
+    location ~ \.php$ {
+        include snippets/fastcgi-php.conf;
+        fastcgi_pass  unix:/run/php/php8.1-fpm.sock;
+    }
+    location ~* \.(css|js|gif|ico|jpeg|jpg|png|svg|webp|woff|woff2|ttf|eot)$ {
+        expires max;
+        add_header Cache-Control "public, no-transform";
+        log_not_found off;
+    }
+}
+`, fileContents)
+}
+
+func TestWordPressValidate(t *testing.T) {
+	service := Service{Selection: 12, Domains: "blog.sidsun.com", Port: 443, Additional: Additions{AddCachingConfig: true}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "Root", Message: "is required for preset 12"},
+		{Field: "Additional.AddCachingConfig", Message: "is not used with preset 12, which caches its static assets itself"},
+	}, service.Validate())
+}
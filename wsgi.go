@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WSGIConfig is the Python application server of the wsgi preset and the directories served from disk next to it
+type WSGIConfig struct {
+	Server string // uwsgi (default) or gunicorn
+	Socket string // unix:/path/to/socket or host:port the application server listens on
+	Static string // Directory served at /static/ (ex: STATIC_ROOT of Django), optional
+	Media  string // Directory served at /media/ (ex: MEDIA_ROOT of Django), optional
+}
+
+var wsgiServers = []string{"uwsgi", "gunicorn"}
+
+// directories returns the URL prefixes served from disk and the directories they are aliased to
+func (config WSGIConfig) directories() [][]string {
+	var directories [][]string
+	if config.Static != "" {
+		directories = append(directories, []string{"/static/", config.Static})
+	}
+	if config.Media != "" {
+		directories = append(directories, []string{"/media/", config.Media})
+	}
+	return directories
+}
+
+// validateWSGI reports problems with the application server and directories of the wsgi preset
+func validateWSGI(config WSGIConfig) ValidationErrors {
+	var errs ValidationErrors
+	if config.Server != "" && !inStrings(config.Server, wsgiServers) {
+		errs = append(errs, FieldError{Field: "WSGI.Server", Message: fmt.Sprintf("%q is not an application server, must be one of %s", config.Server, strings.Join(wsgiServers, ", "))})
+	}
+	// uwsgi_pass takes the same addresses as fastcgi_pass, gunicorn ones are passed on with http://
+	if config.Socket == "" {
+		errs = append(errs, FieldError{Field: "WSGI.Socket", Message: "is required for preset 11"})
+	} else if !isFastCGIAddress(config.Socket) {
+		errs = append(errs, FieldError{Field: "WSGI.Socket", Message: fmt.Sprintf("%q is not a unix:/path socket or host:port", config.Socket)})
+	}
+	for _, directory := range []struct{ field, value string }{{"WSGI.Static", config.Static}, {"WSGI.Media", config.Media}} {
+		if directory.value != "" && (!strings.HasPrefix(directory.value, "/") || strings.ContainsAny(directory.value, " \t;{}")) {
+			errs = append(errs, FieldError{Field: directory.field, Message: fmt.Sprintf("%q is not an absolute path without spaces, semicolons and braces", directory.value)})
+		}
+	}
+	return errs
+}
+
+// buildWSGILocations creates the locations serving the directories from disk followed by location / passing the other
+// requests to the application server, uwsgi_params and the forwarded headers give it the details of the request
+func buildWSGILocations(config WSGIConfig) []Node {
+	var locations []Node
+	for _, directory := range config.directories() {
+		// alias replaces the prefix, both need the trailing slash or files would be looked up next to the directory
+		alias := directory[1]
+		if !strings.HasSuffix(alias, "/") {
+			alias += "/"
+		}
+		locations = append(locations, newBlock("location", directory[0]).add(newDirective("alias", alias)))
+	}
+	if config.Server == "gunicorn" {
+		return append(locations, buildProxyLocation([]string{"/"}, "http://"+config.Socket, ProxyConfig{ForwardHeaders: true}, false, false))
+	}
+	return append(locations, newBlock("location", "/").add(
+		newDirective("include", "uwsgi_params"),
+		newDirective("uwsgi_pass", config.Socket),
+	))
+}
+
+// importWSGIDirectories maps the /static/ and /media/ alias locations onto config, returns the other locations
+func importWSGIDirectories(config *WSGIConfig, locations []*Directive) []*Directive {
+	var others []*Directive
+	for _, location := range locations {
+		alias := location.find("alias")
+		if len(location.Args) != 1 || alias == nil || len(alias.Args) != 1 || len(location.Block) != 1 {
+			others = append(others, location)
+			continue
+		}
+		directory := strings.TrimSuffix(unquote(alias.Args[0]), "/")
+		switch {
+		case location.Args[0] == "/static/" && config.Static == "":
+			config.Static = directory
+		case location.Args[0] == "/media/" && config.Media == "":
+			config.Media = directory
+		default:
+			others = append(others, location)
+		}
+	}
+	return others
+}
+
+// importUWSGI reads the application server of a location / with uwsgi_pass, warning about what it can't represent
+func importUWSGI(location *Directive, warn func(format string, args ...interface{})) WSGIConfig {
+	config := WSGIConfig{Socket: unquote(location.find("uwsgi_pass").Args[0])}
+	for _, node := range location.Block {
+		directive, ok := node.(*Directive)
+		if !ok || directive.Commented {
+			continue
+		}
+		args := unquoteArgs(directive.Args)
+		switch name := directive.Name; {
+		case name == "uwsgi_pass":
+		case name == "include" && len(args) == 1 && args[0] == "uwsgi_params":
+		default:
+			warn("line %d: directive %s in location / is not supported and will be dropped", directive.Line, name)
+		}
+	}
+	return config
+}
+
+// importGunicorn turns a proxy to a host:port or socket with the /static/ or /media/ aliases of the wsgi preset into it,
+// other proxies are left alone, returns the remaining locations
+func importGunicorn(server *Service, locations []*Directive) []*Directive {
+	proxy := server.Proxy
+	proxy.ForwardHeaders = false
+	socket := strings.TrimPrefix(server.URL, "http://")
+	if !server.Proxy.ForwardHeaders || proxy.configured() || !isFastCGIAddress(socket) {
+		return locations
+	}
+	config := WSGIConfig{Server: "gunicorn", Socket: socket}
+	others := importWSGIDirectories(&config, locations)
+	if config.Static == "" && config.Media == "" {
+		return locations
+	}
+	server.Selection, server.URL, server.Proxy, server.WSGI = 11, "", ProxyConfig{}, config
+	return others
+}
+
+// isWSGIDirectory reports whether path is one of the prefixes served from the directories of config
+func isWSGIDirectory(config WSGIConfig, path string) bool {
+	for _, directory := range config.directories() {
+		if directory[0] == path {
+			return true
+		}
+	}
+	return false
+}
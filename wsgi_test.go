@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareServiceFileContentsWSGI(t *testing.T) {
+	testCases := []struct {
+		name             string
+		config           WSGIConfig
+		expectedLocation string
+	}{
+		{
+			name:   "test uwsgi",
+			config: WSGIConfig{Socket: "unix:/run/uwsgi/app.sock", Static: "/srv/app/static", Media: "/srv/app/media/"},
+			expectedLocation: `    location /static/ {
+        alias /srv/app/static/;
+    }
+    location /media/ {
+        alias /srv/app/media/;
+    }
+    location / {
+        include uwsgi_params;
+        uwsgi_pass unix:/run/uwsgi/app.sock;
+    }
+`,
+		},
+		{
+			name:   "test gunicorn",
+			config: WSGIConfig{Server: "gunicorn", Socket: "unix:/run/gunicorn.sock", Static: "/srv/app/static"},
+			expectedLocation: `    location /static/ {
+        alias /srv/app/static/;
+    }
+    location / {
+        proxy_pass http://unix:/run/gunicorn.sock;
+        proxy_read_timeout  90;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			service := Service{Selection: 11, Domains: "django.sidsun.com", WSGI: testCase.config, Port: 8080}
+			_, fileContents := prepareServiceFileContents(service)
+			assert.Equal(t, `server {
+    listen 8080 http2;
+    listen [::]:8080 http2;
+    server_name django.sidsun.com;
+    access_log off;
+    error_log /dev/null crit;
+`+testCase.expectedLocation+"}\n", fileContents)
+		})
+	}
+}
+
+func TestWSGIValidate(t *testing.T) {
+	service := Service{Selection: 11, Domains: "django.sidsun.com", Port: 443, WSGI: WSGIConfig{Server: "waitress", Socket: "/run/uwsgi/app.sock", Static: "static"},
+		Locations: []Location{{Path: "/static/", Selection: 2, Root: "/srv/www"}}}
+	assert.Equal(t, ValidationErrors{
+		{Field: "WSGI.Server", Message: `"waitress" is not an application server, must be one of uwsgi, gunicorn`},
+		{Field: "WSGI.Socket", Message: `"/run/uwsgi/app.sock" is not a unix:/path socket or host:port`},
+		{Field: "WSGI.Static", Message: `"static" is not an absolute path without spaces, semicolons and braces`},
+		{Field: "Locations", Message: `"/static/": is served from the directories of the wsgi preset`},
+	}, service.Validate())
+
+	service = Service{Selection: 5, Domains: "sidsun.com", URL: "http://127.0.0.1:8000", Port: 443, WSGI: WSGIConfig{Static: "/srv/app/static"}}
+	assert.Equal(t, ValidationErrors{{Field: "WSGI", Message: "is only used with preset 11"}}, service.Validate())
+
+	service = Service{Selection: 11, Domains: "django.sidsun.com", Port: 443, WSGI: WSGIConfig{Socket: "unix:/run/uwsgi/app.sock", Static: "/srv/app/static"}, Additional: Additions{AddCachingConfig: true}}
+	assert.Equal(t, ValidationErrors{{Field: "Additional.AddCachingConfig", Message: "can't be used with preset 11, its regex would take the requests of /static/, /media/ and the app"}}, service.Validate())
+}